@@ -0,0 +1,283 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/msaldanha/setinstone/address"
+
+	"github.com/msaldanha/pulpit/models"
+	"github.com/msaldanha/pulpit/server"
+	"github.com/msaldanha/pulpit/service"
+)
+
+func addressCmd(args []string) error {
+	if len(args) == 0 {
+		return usageError("missing address subcommand")
+	}
+	switch args[0] {
+	case "create":
+		return addressCreate(args[1:])
+	case "list":
+		return addressList(args[1:])
+	case "delete":
+		return addressDelete(args[1:])
+	case "passwd":
+		return addressPasswd(args[1:])
+	case "export":
+		return addressExport(args[1:])
+	case "import":
+		return addressImport(args[1:])
+	case "recover":
+		return addressRecover(args[1:])
+	default:
+		return usageError("unknown address subcommand %q", args[0])
+	}
+}
+
+func addressCreate(args []string) error {
+	fs := newFlagSet("address create")
+	data := dataFlag(fs)
+	password := passwordFlag(fs)
+	mnemonic := fs.Bool("mnemonic", false, "Derives the address from a new mnemonic, printed after the address. "+
+		"Write it down: it is the only way to recover the address if the data file is lost")
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+
+	pass, er := readPassword(*password, "Password: ")
+	if er != nil {
+		return er
+	}
+
+	return withAddresses(*data, func(addresses *service.Addresses) error {
+		if *mnemonic {
+			a, words, er := addresses.CreateWithMnemonic(pass)
+			if er != nil {
+				return er
+			}
+			fmt.Fprintln(stdout, a.Address)
+			fmt.Fprintln(stdout, words)
+			return nil
+		}
+		a, er := addresses.Create(pass)
+		if er != nil {
+			return er
+		}
+		fmt.Fprintln(stdout, a.Address)
+		return nil
+	})
+}
+
+func addressList(args []string) error {
+	fs := newFlagSet("address list")
+	data := dataFlag(fs)
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+
+	return withAddresses(*data, func(addresses *service.Addresses) error {
+		all, er := addresses.List()
+		if er != nil {
+			return er
+		}
+		for _, a := range all {
+			fmt.Fprintln(stdout, a.Address)
+		}
+		return nil
+	})
+}
+
+func addressDelete(args []string) error {
+	fs := newFlagSet("address delete")
+	data := dataFlag(fs)
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() != 1 {
+		return usageError("address delete expects the address")
+	}
+
+	addr := fs.Arg(0)
+	return withDataStore(*data, func(db *bolt.DB) error {
+		if er := service.NewAddresses(server.NewAddressStore(db)).Delete(addr); er != nil {
+			return er
+		}
+		// the api keys of a post scope keep the private key, so they must go with the address
+		return server.NewApiKeys(db).RevokeAll(addr)
+	})
+}
+
+func addressPasswd(args []string) error {
+	fs := newFlagSet("address passwd")
+	data := dataFlag(fs)
+	password := passwordFlag(fs)
+	newPassword := fs.String("newpassword", "", "New password. If empty, it is read from "+newPasswordEnv+
+		" or from the standard input")
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() != 1 {
+		return usageError("address passwd expects the address")
+	}
+
+	oldPass, er := readPassword(*password, "Current password: ")
+	if er != nil {
+		return er
+	}
+	newPass, er := readSecret(*newPassword, newPasswordEnv, "New password: ")
+	if er != nil {
+		return er
+	}
+
+	addr := fs.Arg(0)
+	return withDataStore(*data, func(db *bolt.DB) error {
+		addresses := service.NewAddresses(server.NewAddressStore(db))
+		if er := addresses.ChangePassword(addr, oldPass, newPass); er != nil {
+			return er
+		}
+		// the tokens issued before the change are not accepted by the server anymore
+		return server.NewRevocations(db).RevokeIssuedBefore(addr, time.Now())
+	})
+}
+
+func keystorePasswordFlag(fs *flag.FlagSet) *string {
+	return fs.String("keystorepassword", "", "Keystore password. If empty, it is read from "+keystorePasswordEnv+
+		" or from the standard input")
+}
+
+func addressExport(args []string) error {
+	fs := newFlagSet("address export")
+	data := dataFlag(fs)
+	password := passwordFlag(fs)
+	keystorePassword := keystorePasswordFlag(fs)
+	out := fs.String("out", "", "Keystore file. If empty, the keystore is written to the standard output")
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() != 1 {
+		return usageError("address export expects the address")
+	}
+
+	pass, er := readPassword(*password, "Password: ")
+	if er != nil {
+		return er
+	}
+	keystorePass, er := readSecret(*keystorePassword, keystorePasswordEnv, "Keystore password: ")
+	if er != nil {
+		return er
+	}
+
+	return withAddresses(*data, func(addresses *service.Addresses) error {
+		ks, er := addresses.Export(fs.Arg(0), pass, keystorePass)
+		if er != nil {
+			return er
+		}
+		buf, er := json.MarshalIndent(ks, "", "  ")
+		if er != nil {
+			return er
+		}
+		if *out == "" {
+			_, er = fmt.Fprintln(stdout, string(buf))
+			return er
+		}
+		return os.WriteFile(*out, buf, 0600)
+	})
+}
+
+func addressImport(args []string) error {
+	fs := newFlagSet("address import")
+	data := dataFlag(fs)
+	password := passwordFlag(fs)
+	keystorePassword := keystorePasswordFlag(fs)
+	privateKey := fs.Bool("privatekey", false, "Imports a raw private key, read from "+privateKeyEnv+
+		" or from the standard input, instead of a keystore file")
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if *privateKey == (fs.NArg() == 1) || fs.NArg() > 1 {
+		return usageError("address import expects either the keystore file or -privatekey")
+	}
+
+	var ks *models.Keystore
+	var key, keystorePass string
+	var er error
+	if *privateKey {
+		key, er = readSecret("", privateKeyEnv, "Private key: ")
+	} else {
+		ks, er = readKeystore(fs.Arg(0))
+		if er == nil {
+			keystorePass, er = readSecret(*keystorePassword, keystorePasswordEnv, "Keystore password: ")
+		}
+	}
+	if er != nil {
+		return er
+	}
+	pass, er := readPassword(*password, "New local password: ")
+	if er != nil {
+		return er
+	}
+
+	return withAddresses(*data, func(addresses *service.Addresses) error {
+		var a *address.Address
+		if ks != nil {
+			a, er = addresses.Import(ks, keystorePass, pass)
+		} else {
+			a, er = addresses.ImportPrivateKey(key, pass)
+		}
+		if er != nil {
+			return er
+		}
+		fmt.Fprintln(stdout, a.Address)
+		return nil
+	})
+}
+
+func readKeystore(path string) (*models.Keystore, error) {
+	buf, er := os.ReadFile(path)
+	if er != nil {
+		return nil, er
+	}
+	ks := &models.Keystore{}
+	if er = json.Unmarshal(buf, ks); er != nil {
+		return nil, fmt.Errorf("%w: %s", service.ErrInvalidKeystore, er)
+	}
+	return ks, nil
+}
+
+func addressRecover(args []string) error {
+	fs := newFlagSet("address recover")
+	data := dataFlag(fs)
+	password := passwordFlag(fs)
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+
+	mnemonic, er := readSecret("", mnemonicEnv, "Mnemonic: ")
+	if er != nil {
+		return er
+	}
+	pass, er := readPassword(*password, "New local password: ")
+	if er != nil {
+		return er
+	}
+
+	return withDataStore(*data, func(db *bolt.DB) error {
+		addresses := service.NewAddresses(server.NewAddressStore(db))
+		a, er := addresses.Recover(mnemonic, pass)
+		if er != nil {
+			return er
+		}
+		// if the address was already stored, the tokens issued with the old password are not accepted anymore
+		if er = server.NewRevocations(db).RevokeIssuedBefore(a.Address, time.Now()); er != nil {
+			return er
+		}
+		fmt.Fprintln(stdout, a.Address)
+		return nil
+	})
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/msaldanha/pulpit/server"
+)
+
+// backup downloads a snapshot of the data file of a running server, logging in as one of its admin addresses
+func backup(args []string) error {
+	fs := newFlagSet("backup")
+	serverUrl := fs.String("server", "http://localhost:8080", "Base url of the running server")
+	password := passwordFlag(fs)
+	out := fs.String("out", "", "Snapshot file. Defaults to pulpit-<TIME>.dat in the current directory")
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() != 1 {
+		return usageError("backup expects the admin address")
+	}
+	addr := fs.Arg(0)
+	if *out == "" {
+		*out = fmt.Sprintf("pulpit-%s.dat", time.Now().Format("20060102150405"))
+	}
+
+	pass, er := readPassword(*password, "Password: ")
+	if er != nil {
+		return er
+	}
+
+	client := newApiClient(*serverUrl)
+	er = client.login(addr, pass)
+	if er != nil {
+		return er
+	}
+	defer client.logout()
+
+	// the snapshot only takes the place of out once it is whole and valid
+	tmp, er := os.CreateTemp(filepath.Dir(*out), filepath.Base(*out)+".download-*")
+	if er != nil {
+		return er
+	}
+	defer os.Remove(tmp.Name())
+
+	size, er := client.download("/admin/backup", tmp)
+	if er == nil {
+		er = tmp.Sync()
+	}
+	if closeEr := tmp.Close(); er == nil {
+		er = closeEr
+	}
+	if er != nil {
+		return er
+	}
+
+	version, er := server.ValidateSnapshot(tmp.Name())
+	if er != nil {
+		return er
+	}
+	if er = os.Rename(tmp.Name(), *out); er != nil {
+		return er
+	}
+	fmt.Fprintf(stdout, "snapshot of schema version %d (%d bytes) written to %s\n", version, size, *out)
+	return nil
+}
+
+// restore replaces the data file with a snapshot, after validating it. The server must not be running.
+func restore(args []string) error {
+	fs := newFlagSet("restore")
+	data := dataFlag(fs)
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() != 1 {
+		return usageError("restore expects the snapshot file")
+	}
+
+	res, er := server.Restore(fs.Arg(0), *data)
+	if er != nil {
+		return er
+	}
+	if res.Backup != "" {
+		fmt.Fprintf(stdout, "previous data file saved to %s\n", res.Backup)
+	}
+	fmt.Fprintf(stdout, "%s restored from %s (schema version %d)\n", *data, fs.Arg(0), res.Version)
+	return nil
+}
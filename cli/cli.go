@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/msaldanha/pulpit/server"
+	"github.com/msaldanha/pulpit/service"
+)
+
+const usage = `Usage: pulpit <command> [arguments]
+
+Commands:
+  serve                                     Runs the server (default when no command is given)
+  address create                            Creates a new address (derived from a mnemonic with -mnemonic)
+  address list                              Lists the local addresses
+  address delete <addr>                     Deletes a local address
+  address passwd <addr>                     Changes the password of a local address
+  address export <addr>                     Writes a local address as a keystore file
+  address import [<keystore file>]          Imports a keystore file (or a raw private key with -privatekey)
+  address recover                           Rebuilds an address from its mnemonic
+  subscriptions list <owner>                Lists the subscriptions of owner
+  subscriptions add <owner> <addr>          Subscribes owner to addr
+  subscriptions remove <owner> <addr>       Unsubscribes owner from addr
+  migrate                                   Migrates the data file to the current schema version (-dryrun lists
+                                            the pending migrations only)
+  restore <snapshot file>                   Replaces the data file with a snapshot, after validating it
+  post <addr> <text>                        Posts text to the timeline of addr through a running server
+  feed                                      Reads the subscriptions feed of the address of a private key (read
+                                            from PULPIT_PRIVATE_KEY) through a running server, without sending it
+  backup <admin addr>                       Downloads a snapshot of the data file of a running server
+
+The address, subscriptions, migrate and restore commands work directly on the data file, so the server must not be
+running.
+Run "pulpit <command> -h" for the command options.
+`
+
+const (
+	passwordEnv         = "PULPIT_PASSWORD"
+	newPasswordEnv      = "PULPIT_NEW_PASSWORD"
+	keystorePasswordEnv = "PULPIT_KEYSTORE_PASSWORD"
+	privateKeyEnv       = "PULPIT_PRIVATE_KEY"
+	mnemonicEnv         = "PULPIT_MNEMONIC"
+)
+
+var (
+	errUsage = errors.New("invalid usage")
+
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+
+	// input buffers stdin, so that more than one line can be read from it
+	input *bufio.Reader
+)
+
+type command func(args []string) error
+
+var commands = map[string]command{
+	"serve":         serve,
+	"address":       addressCmd,
+	"subscriptions": subscriptionsCmd,
+	"post":          post,
+	"feed":          feed,
+	"migrate":       migrate,
+	"backup":        backup,
+	"restore":       restore,
+}
+
+// Run executes the command given by args and returns the process exit code
+func Run(args []string) int {
+	cmd := serve
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name := args[0]
+		if name == "help" {
+			fmt.Fprint(stdout, usage)
+			return 0
+		}
+		var found bool
+		cmd, found = commands[name]
+		if !found {
+			fmt.Fprintf(stderr, "unknown command %q\n\n%s", name, usage)
+			return 2
+		}
+		args = args[1:]
+	}
+
+	er := cmd(args)
+	switch {
+	case er == nil, errors.Is(er, flag.ErrHelp):
+		return 0
+	case errors.Is(er, errUsage):
+		fmt.Fprintf(stderr, "pulpit: %s\n\n%s", er, usage)
+		return 2
+	default:
+		fmt.Fprintf(stderr, "pulpit: %s\n", er)
+		return 1
+	}
+}
+
+func usageError(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", errUsage, fmt.Sprintf(format, a...))
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+func dataFlag(fs *flag.FlagSet) *string {
+	return fs.String("data", server.DefaultOptions().DataStore, "Data Store file")
+}
+
+func passwordFlag(fs *flag.FlagSet) *string {
+	return fs.String("password", "", "Password. If empty, it is read from "+passwordEnv+" or from the standard input")
+}
+
+// readPassword returns pass if not empty, otherwise looks for it in the environment and then in the standard input
+func readPassword(pass, prompt string) (string, error) {
+	return readSecret(pass, passwordEnv, prompt)
+}
+
+// readSecret returns value if not empty, otherwise looks for it in the env variable and then in the standard input
+func readSecret(pass, env, prompt string) (string, error) {
+	if pass != "" {
+		return pass, nil
+	}
+	if pass = os.Getenv(env); pass != "" {
+		return pass, nil
+	}
+	fmt.Fprint(stderr, prompt)
+	if input == nil {
+		input = bufio.NewReader(stdin)
+	}
+	line, er := input.ReadString('\n')
+	if er != nil && !errors.Is(er, io.EOF) {
+		return "", er
+	}
+	pass = strings.TrimRight(line, "\r\n")
+	if pass == "" {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+	return pass, nil
+}
+
+func withDataStore(path string, f func(db *bolt.DB) error) error {
+	db, er := server.OpenDataStore(path)
+	if er != nil {
+		return er
+	}
+	defer db.Close()
+	return f(db)
+}
+
+func withAddresses(path string, f func(addresses *service.Addresses) error) error {
+	return withDataStore(path, func(db *bolt.DB) error {
+		return f(service.NewAddresses(server.NewAddressStore(db)))
+	})
+}
+
+func withSubscriptions(path string, f func(subs *service.SubscriptionsStoreImpl) error) error {
+	return withDataStore(path, func(db *bolt.DB) error {
+		subs, er := server.NewSubscriptionsStore(db)
+		if er != nil {
+			return er
+		}
+		return f(subs)
+	})
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Run", func() {
+	var dir, data string
+	var out, errOut *bytes.Buffer
+
+	BeforeEach(func() {
+		var er error
+		dir, er = os.MkdirTemp("", "pulpit-cli")
+		Expect(er).To(BeNil())
+		data = filepath.Join(dir, "pulpit.dat")
+		out, errOut = &bytes.Buffer{}, &bytes.Buffer{}
+		stdout, stderr = out, errOut
+		setStdin("")
+	})
+
+	AfterEach(func() {
+		stdin, stdout, stderr = os.Stdin, os.Stdout, os.Stderr
+		input = nil
+		_ = os.RemoveAll(dir)
+	})
+
+	// run runs the command given by args and returns its exit code and what it wrote to stdout
+	run := func(args ...string) (int, string) {
+		out.Reset()
+		code := Run(args)
+		return code, out.String()
+	}
+
+	It("Should answer 2 and print the usage for an unknown command or subcommand", func() {
+		code, _ := run("unknown")
+		Expect(code).To(Equal(2))
+		Expect(errOut.String()).To(ContainSubstring(`unknown command "unknown"`))
+		Expect(errOut.String()).To(ContainSubstring("Usage: pulpit"))
+
+		errOut.Reset()
+		code, _ = run("address", "rename")
+		Expect(code).To(Equal(2))
+		Expect(errOut.String()).To(ContainSubstring("Usage: pulpit"))
+
+		code, usage := run("help")
+		Expect(code).To(Equal(0))
+		Expect(usage).To(HavePrefix("Usage: pulpit"))
+	})
+
+	It("Should create, list and delete the addresses of the data file", func() {
+		code, created := run("address", "create", "-data", data, "-password", "p")
+		Expect(code).To(Equal(0), errOut.String())
+		addr := strings.TrimSpace(created)
+		Expect(addr).NotTo(BeEmpty())
+
+		code, listed := run("address", "list", "-data", data)
+		Expect(code).To(Equal(0), errOut.String())
+		Expect(strings.Fields(listed)).To(Equal([]string{addr}))
+
+		Expect(run("address", "delete", "-data", data, addr)).To(Equal(0))
+		_, listed = run("address", "list", "-data", data)
+		Expect(listed).To(BeEmpty())
+	})
+
+	It("Should read the password from the environment or from the standard input", func() {
+		os.Setenv(passwordEnv, "p")
+		code, _ := run("address", "create", "-data", data)
+		os.Unsetenv(passwordEnv)
+		Expect(code).To(Equal(0), errOut.String())
+
+		setStdin("p\n")
+		code, _ = run("address", "create", "-data", data)
+		Expect(code).To(Equal(0), errOut.String())
+		Expect(errOut.String()).To(ContainSubstring("Password: "))
+
+		setStdin("")
+		code, _ = run("address", "create", "-data", data)
+		Expect(code).To(Equal(1))
+		Expect(errOut.String()).To(ContainSubstring("password cannot be empty"))
+
+		_, listed := run("address", "list", "-data", data)
+		Expect(strings.Fields(listed)).To(HaveLen(2))
+	})
+
+	It("Should add, list and remove the subscriptions of an owner", func() {
+		Expect(run("subscriptions", "add", "-data", data, "owner", "a")).To(Equal(0))
+		Expect(run("subscriptions", "add", "-data", data, "owner", "b")).To(Equal(0))
+		_, listed := run("subscriptions", "list", "-data", data, "owner")
+		Expect(strings.Fields(listed)).To(ConsistOf("a", "b"))
+
+		Expect(run("subscriptions", "remove", "-data", data, "owner", "a")).To(Equal(0))
+		_, listed = run("subscriptions", "list", "-data", data, "owner")
+		Expect(strings.Fields(listed)).To(Equal([]string{"b"}))
+
+		code, _ := run("subscriptions", "add", "-data", data, "owner")
+		Expect(code).To(Equal(2))
+	})
+})
+
+// setStdin makes the commands read s as their standard input
+func setStdin(s string) {
+	stdin = strings.NewReader(s)
+	input = nil
+}
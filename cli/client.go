@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/msaldanha/setinstone/address"
+
+	"github.com/msaldanha/pulpit/models"
+	"github.com/msaldanha/pulpit/service"
+)
+
+const apiPath = "/api/v1"
+
+// apiClient talks to the REST api of a running server
+type apiClient struct {
+	baseUrl string
+	token   string
+	http    *http.Client
+}
+
+type apiResponse struct {
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+func newApiClient(baseUrl string) *apiClient {
+	return &apiClient{
+		baseUrl: strings.TrimSuffix(baseUrl, "/") + apiPath,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *apiClient) login(addr, pass string) error {
+	tokens := models.LoginResponse{}
+	er := c.do(http.MethodPost, "/login", models.LoginRequest{Address: addr, Password: pass}, &tokens)
+	if er != nil {
+		return er
+	}
+	c.token = tokens.Token
+	return nil
+}
+
+// logout ends the session of the token, so it does not wait for the tokens to expire. A failure is only reported on
+// stderr, as the command itself is done.
+func (c *apiClient) logout() {
+	if c.token == "" {
+		return
+	}
+	if er := c.do(http.MethodPost, "/logout", nil, nil); er != nil {
+		fmt.Fprintf(stderr, "pulpit: failed to logout: %s\n", er)
+	}
+	c.token = ""
+}
+
+// loginWithKey logs a in by signing a challenge with its private key, which is not sent to the server
+func (c *apiClient) loginWithKey(a *address.Address) error {
+	ch := models.Challenge{}
+	er := c.do(http.MethodPost, "/challenge", models.ChallengeRequest{Address: a.Address}, &ch)
+	if er != nil {
+		return er
+	}
+	signature, er := service.SignChallenge(a, ch)
+	if er != nil {
+		return er
+	}
+	tokens := models.LoginResponse{}
+	er = c.do(http.MethodPost, "/login", models.LoginRequest{
+		Address:   a.Address,
+		PublicKey: a.Keys.PublicKey,
+		Nonce:     ch.Nonce,
+		Signature: signature,
+	}, &tokens)
+	if er != nil {
+		return er
+	}
+	c.token = tokens.Token
+	return nil
+}
+
+func (c *apiClient) getSubscriptionsPublications(addr string, count int) (json.RawMessage, error) {
+	items := json.RawMessage{}
+	er := c.do(http.MethodGet, fmt.Sprintf("/%s/subscriptions/publications?count=%d", addr, count), nil, &items)
+	return items, er
+}
+
+func (c *apiClient) createItem(addr string, item models.AddItemRequest) (string, error) {
+	key := ""
+	er := c.do(http.MethodPost, "/"+addr+"/publications", item, &key)
+	return key, er
+}
+
+// download writes to w the body of a GET of path, checking it was received whole. It has no timeout, as the body can
+// be large.
+func (c *apiClient) download(path string, w io.Writer) (int64, error) {
+	req, er := http.NewRequest(http.MethodGet, c.baseUrl+path, nil)
+	if er != nil {
+		return 0, er
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	client := *c.http
+	client.Timeout = 0
+	resp, er := client.Do(req)
+	if er != nil {
+		return 0, er
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		r := apiResponse{}
+		if er = json.NewDecoder(resp.Body).Decode(&r); er == nil && r.Error != "" {
+			return 0, fmt.Errorf("GET %s: %s (%d)", path, r.Error, resp.StatusCode)
+		}
+		return 0, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	n, er := io.Copy(w, resp.Body)
+	if er != nil {
+		return n, fmt.Errorf("GET %s: %w", path, er)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return n, fmt.Errorf("GET %s: received %d of %d bytes", path, n, resp.ContentLength)
+	}
+	return n, nil
+}
+
+func (c *apiClient) do(method, path string, body, payload interface{}) error {
+	buf, er := json.Marshal(body)
+	if er != nil {
+		return er
+	}
+	req, er := http.NewRequest(method, c.baseUrl+path, bytes.NewReader(buf))
+	if er != nil {
+		return er
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, er := c.http.Do(req)
+	if er != nil {
+		return er
+	}
+	defer resp.Body.Close()
+
+	r := apiResponse{}
+	er = json.NewDecoder(resp.Body).Decode(&r)
+	if resp.StatusCode != http.StatusOK {
+		if er == nil && r.Error != "" {
+			return fmt.Errorf("%s %s: %s (%d)", method, path, r.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if er != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", method, path, er)
+	}
+	if payload == nil || len(r.Payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Payload, payload)
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/msaldanha/setinstone/address"
+)
+
+// feed reads the subscriptions feed of the address of a private key kept by the user, logging in with a signed
+// challenge, so the key never leaves this machine
+func feed(args []string) error {
+	fs := newFlagSet("feed")
+	serverUrl := fs.String("server", "http://localhost:8080", "Base url of the running server")
+	count := fs.Int("count", 20, "Number of items to read")
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() != 0 {
+		return usageError("feed expects no arguments")
+	}
+
+	key, er := readSecret("", privateKeyEnv, "Private key: ")
+	if er != nil {
+		return er
+	}
+	keys := address.Keys{PrivateKey: key}
+	pk, er := keys.ToEcdsaPrivateKey()
+	if er != nil || pk == nil {
+		return fmt.Errorf("invalid private key")
+	}
+	a, er := address.NewAddressFromPrivateKey(pk)
+	if er != nil {
+		return er
+	}
+
+	client := newApiClient(*serverUrl)
+	er = client.loginWithKey(a)
+	if er != nil {
+		return er
+	}
+	defer client.logout()
+
+	items, er := client.getSubscriptionsPublications(a.Address, *count)
+	if er != nil {
+		return er
+	}
+
+	if len(items) == 0 {
+		items = []byte("[]")
+	}
+	fmt.Fprintln(stdout, string(items))
+	return nil
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/msaldanha/pulpit/server"
+)
+
+// migrate brings the data file to the current schema version, as the server does on startup. With -dryrun it only
+// lists the pending migrations.
+func migrate(args []string) error {
+	fs := newFlagSet("migrate")
+	data := dataFlag(fs)
+	dryRun := fs.Bool("dryrun", false, "Only lists the pending migrations")
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() != 0 {
+		return usageError("migrate expects no arguments")
+	}
+
+	return withDataStore(*data, func(db *bolt.DB) error {
+		res, er := server.Migrate(db, *data, *dryRun)
+		if er != nil {
+			return er
+		}
+		if len(res.Pending) == 0 {
+			fmt.Fprintf(stdout, "schema version %d is up to date\n", res.From)
+			return nil
+		}
+		for _, m := range res.Pending {
+			fmt.Fprintf(stdout, "%d: %s\n", m.Version, m.Description)
+		}
+		if *dryRun {
+			fmt.Fprintf(stdout, "schema version %d, %d pending migrations\n", res.From, len(res.Pending))
+			return nil
+		}
+		if res.Backup != "" {
+			fmt.Fprintf(stdout, "backup written to %s\n", res.Backup)
+		}
+		fmt.Fprintf(stdout, "migrated from schema version %d to %d\n", res.From, res.To)
+		return nil
+	})
+}
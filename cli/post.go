@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/msaldanha/timeline"
+
+	"github.com/msaldanha/pulpit/models"
+)
+
+func post(args []string) error {
+	fs := newFlagSet("post")
+	serverUrl := fs.String("server", "http://localhost:8080", "Base url of the running server")
+	password := passwordFlag(fs)
+	mimeType := fs.String("mimetype", "text/plain", "Mime type of the text")
+	connectors := fs.String("connectors", "like", "Comma separated list of connectors allowed on the post")
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() < 2 {
+		return usageError("post expects the address and the text")
+	}
+	addr := fs.Arg(0)
+	text := strings.Join(fs.Args()[1:], " ")
+
+	pass, er := readPassword(*password, "Password: ")
+	if er != nil {
+		return er
+	}
+
+	client := newApiClient(*serverUrl)
+	er = client.login(addr, pass)
+	if er != nil {
+		return er
+	}
+	defer client.logout()
+
+	key, er := client.createItem(addr, models.AddItemRequest{
+		Type: timeline.TypePost,
+		PostItem: models.PostItem{
+			Part: timeline.Part{
+				MimeType: *mimeType,
+				Body:     text,
+			},
+			Connectors: strings.Split(*connectors, ","),
+		},
+	})
+	if er != nil {
+		return er
+	}
+
+	fmt.Fprintln(stdout, key)
+	return nil
+}
@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"github.com/msaldanha/pulpit/server"
+)
+
+func serve(args []string) error {
+	opts, er := server.LoadOptions(args)
+	if er != nil {
+		return er
+	}
+
+	p, er := server.NewServer(opts)
+	if er != nil {
+		return er
+	}
+
+	return p.Run()
+}
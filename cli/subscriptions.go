@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/msaldanha/pulpit/models"
+	"github.com/msaldanha/pulpit/service"
+)
+
+func subscriptionsCmd(args []string) error {
+	if len(args) == 0 {
+		return usageError("missing subscriptions subcommand")
+	}
+	switch args[0] {
+	case "list":
+		return subscriptionsList(args[1:])
+	case "add":
+		return subscriptionsChange(args[1:], "add")
+	case "remove":
+		return subscriptionsChange(args[1:], "remove")
+	default:
+		return usageError("unknown subscriptions subcommand %q", args[0])
+	}
+}
+
+func subscriptionsList(args []string) error {
+	fs := newFlagSet("subscriptions list")
+	data := dataFlag(fs)
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() != 1 {
+		return usageError("subscriptions list expects the owner address")
+	}
+
+	return withSubscriptions(*data, func(subs *service.SubscriptionsStoreImpl) error {
+		all, er := subs.GetAllSubscriptionsForOwner(fs.Arg(0))
+		if er != nil {
+			return er
+		}
+		for _, sub := range all {
+			fmt.Fprintln(stdout, sub.Address)
+		}
+		return nil
+	})
+}
+
+// subscriptionsChange adds or removes a subscription. The owner composite timeline picks the change up on its next login.
+func subscriptionsChange(args []string, op string) error {
+	fs := newFlagSet("subscriptions " + op)
+	data := dataFlag(fs)
+	if er := fs.Parse(args); er != nil {
+		return er
+	}
+	if fs.NArg() != 2 {
+		return usageError("subscriptions %s expects the owner and the subscribed addresses", op)
+	}
+
+	sub := models.Subscription{Owner: fs.Arg(0), Address: fs.Arg(1)}
+	return withSubscriptions(*data, func(subs *service.SubscriptionsStoreImpl) error {
+		if op == "add" {
+			return subs.AddSubscription(sub)
+		}
+		return subs.RemoveSubscription(sub)
+	})
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NodeStats are the values of a running node collected on each scrape
+type NodeStats struct {
+	Logins             int
+	UnlockedKeys       int
+	Timelines          int
+	CompositeTimelines int
+	Subscriptions      int
+	Peers              int
+}
+
+// NodeCollector exports the gauges of a node. As more than one node may run in the same process, the
+// metrics are labeled with the node id.
+type NodeCollector struct {
+	stats              func() NodeStats
+	logins             *prometheus.Desc
+	unlockedKeys       *prometheus.Desc
+	timelines          *prometheus.Desc
+	compositeTimelines *prometheus.Desc
+	subscriptions      *prometheus.Desc
+	peers              *prometheus.Desc
+}
+
+func NewNodeCollector(nodeId string, stats func() NodeStats) *NodeCollector {
+	labels := prometheus.Labels{"node_id": nodeId}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, labels)
+	}
+	return &NodeCollector{
+		stats:              stats,
+		logins:             desc("logins_active", "Number of logged in addresses."),
+		unlockedKeys:       desc("keys_unlocked", "Number of unlocked private keys."),
+		timelines:          desc("timelines_active", "Number of active timelines."),
+		compositeTimelines: desc("composite_timelines_active", "Number of active composite timelines."),
+		subscriptions:      desc("subscriptions", "Number of stored subscriptions."),
+		peers:              desc("ipfs_peers", "Number of connected IPFS peers."),
+	}
+}
+
+func (c *NodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.logins
+	ch <- c.unlockedKeys
+	ch <- c.timelines
+	ch <- c.compositeTimelines
+	ch <- c.subscriptions
+	ch <- c.peers
+}
+
+func (c *NodeCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.logins, prometheus.GaugeValue, float64(stats.Logins))
+	ch <- prometheus.MustNewConstMetric(c.unlockedKeys, prometheus.GaugeValue, float64(stats.UnlockedKeys))
+	ch <- prometheus.MustNewConstMetric(c.timelines, prometheus.GaugeValue, float64(stats.Timelines))
+	ch <- prometheus.MustNewConstMetric(c.compositeTimelines, prometheus.GaugeValue, float64(stats.CompositeTimelines))
+	ch <- prometheus.MustNewConstMetric(c.subscriptions, prometheus.GaugeValue, float64(stats.Subscriptions))
+	ch <- prometheus.MustNewConstMetric(c.peers, prometheus.GaugeValue, float64(stats.Peers))
+}
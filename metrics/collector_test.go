@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ = Describe("NodeCollector", func() {
+	It("Should export the stats of the node on each scrape, labeled with its id", func() {
+		stats := NodeStats{Logins: 1, UnlockedKeys: 2, Timelines: 3, CompositeTimelines: 4, Subscriptions: 5, Peers: 6}
+		registry := prometheus.NewPedanticRegistry()
+		Expect(registry.Register(NewNodeCollector("node1", func() NodeStats { return stats }))).To(Succeed())
+		// a second node in the same process
+		Expect(registry.Register(NewNodeCollector("node2", func() NodeStats { return NodeStats{} }))).To(Succeed())
+
+		gather := func() map[string]float64 {
+			families, er := registry.Gather()
+			Expect(er).To(BeNil())
+			values := map[string]float64{}
+			for _, f := range families {
+				for _, m := range f.GetMetric() {
+					Expect(m.GetLabel()).To(HaveLen(1))
+					Expect(m.GetLabel()[0].GetName()).To(Equal("node_id"))
+					if m.GetLabel()[0].GetValue() == "node1" {
+						values[f.GetName()] = m.GetGauge().GetValue()
+					}
+				}
+			}
+			return values
+		}
+
+		Expect(gather()).To(Equal(map[string]float64{
+			"pulpit_logins_active":              1,
+			"pulpit_keys_unlocked":              2,
+			"pulpit_timelines_active":           3,
+			"pulpit_composite_timelines_active": 4,
+			"pulpit_subscriptions":              5,
+			"pulpit_ipfs_peers":                 6,
+		}))
+
+		stats.Logins = 0
+		Expect(gather()).To(HaveKeyWithValue("pulpit_logins_active", 0.0))
+	})
+})
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "pulpit"
+
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of REST requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the REST requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	itemsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "items_created_total",
+		Help:      "Number of timeline items created by type (Post or Reference).",
+	}, []string{"type"})
+
+	mediaAdded = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "media_added_total",
+		Help:      "Number of media files added to IPFS.",
+	})
+
+	mediaAddedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "media_added_bytes_total",
+		Help:      "Bytes of media added to IPFS.",
+	})
+
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Number of logins by result (success or failure).",
+	}, []string{"result"})
+)
+
+func ObserveRequest(route, method string, code int, duration time.Duration) {
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(code)).Inc()
+	httpDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+func ItemCreated(itemType string) {
+	itemsCreated.WithLabelValues(itemType).Inc()
+}
+
+func MediaAdded(size int64) {
+	mediaAdded.Inc()
+	if size > 0 {
+		mediaAddedBytes.Add(float64(size))
+	}
+}
+
+func Login(result string) {
+	logins.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,22 @@
+package models
+
+// Keystore is the portable form of an address: its private key and the bookmark check value are encrypted with
+// the keystore password and hex encoded. Since version 2 they are encrypted with AES-GCM using a key derived from
+// the password with Kdf; version 1 encrypts them directly with the password.
+type Keystore struct {
+	Version    int          `json:"version"`
+	Address    string       `json:"address"`
+	PublicKey  string       `json:"publicKey"`
+	PrivateKey string       `json:"privateKey"`
+	Bookmark   string       `json:"bookmark"`
+	Kdf        *KeystoreKdf `json:"kdf,omitempty"`
+}
+
+// KeystoreKdf are the parameters of the key derivation of a keystore, its salt hex encoded
+type KeystoreKdf struct {
+	Algorithm string `json:"algorithm"`
+	Salt      string `json:"salt"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"`
+	Threads   uint32 `json:"threads"`
+}
@@ -35,11 +35,97 @@ type AddReferenceRequest struct {
 	Type   string `json:"type,omitempty"`
 }
 
+// LoginRequest has either the password of a local address or the signature of a challenge made with its key
 type LoginRequest struct {
+	Address   string `json:"address,omitempty"`
+	Password  string `json:"password,omitempty"`
+	PublicKey string `json:"publicKey,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type ChallengeRequest struct {
+	Address string `json:"address,omitempty"`
+}
+
+// Challenge must be signed by the key of an address to login without its password
+type Challenge struct {
+	Nonce     string `json:"nonce,omitempty"`
+	Message   string `json:"message,omitempty"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"oldPassword,omitempty"`
+	NewPassword string `json:"newPassword,omitempty"`
+}
+
+type CreateAddressRequest struct {
+	Password string `json:"password,omitempty"`
+	Mnemonic bool   `json:"mnemonic,omitempty"`
+}
+
+type CreateAddressResponse struct {
 	Address  string `json:"address,omitempty"`
+	Mnemonic string `json:"mnemonic,omitempty"`
+}
+
+type RecoverAddressRequest struct {
+	Mnemonic string `json:"mnemonic,omitempty"`
 	Password string `json:"password,omitempty"`
 }
 
+type ExportAddressRequest struct {
+	Password         string `json:"password,omitempty"`
+	KeystorePassword string `json:"keystorePassword,omitempty"`
+}
+
+type ImportAddressRequest struct {
+	Keystore         *Keystore `json:"keystore,omitempty"`
+	KeystorePassword string    `json:"keystorePassword,omitempty"`
+	PrivateKey       string    `json:"privateKey,omitempty"`
+	Password         string    `json:"password,omitempty"`
+}
+
+type LoginResponse struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	ExpiresAt    int64  `json:"expiresAt,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
 type AddSubscriptionRequest struct {
 	Address string `json:"address,omitempty"`
 }
+
+// ApiKey is a long-lived credential of an address, limited to some scopes
+type ApiKey struct {
+	Id        string   `json:"id"`
+	Address   string   `json:"address"`
+	Name      string   `json:"name,omitempty"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt int64    `json:"createdAt"`
+}
+
+// HasScope tells if the key was granted scope
+func (k ApiKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateApiKeyRequest struct {
+	Name   string   `json:"name,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+type CreateApiKeyResponse struct {
+	ApiKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/msaldanha/pulpit/service"
+)
+
+// RestoreResult tells what Restore did
+type RestoreResult struct {
+	Version int
+	Backup  string
+}
+
+// ValidateSnapshot checks that the file at path is a consistent data file this version can use, and returns its
+// schema version. An older one is migrated by the server on startup.
+func ValidateSnapshot(path string) (int, error) {
+	if _, er := os.Stat(path); er != nil {
+		return 0, er
+	}
+	db, er := bolt.Open(path, 0400, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if er != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidSnapshot, er)
+	}
+	defer db.Close()
+
+	version := 0
+	er = db.View(func(tx *bolt.Tx) error {
+		var er error
+		for checkEr := range tx.Check() {
+			if er == nil {
+				er = checkEr
+			}
+		}
+		if er != nil {
+			return er
+		}
+		version, er = readSchemaVersion(tx)
+		if er != nil {
+			return er
+		}
+		if version > SchemaVersion {
+			return fmt.Errorf("%w: schema version %d, this version only knows up to %d", ErrSchemaTooNew, version,
+				SchemaVersion)
+		}
+		if version > 0 {
+			for _, name := range []string{addressesBucket, subsBucket, settingsBucket} {
+				if tx.Bucket([]byte(name)) == nil {
+					return fmt.Errorf("bucket %s is missing", name)
+				}
+			}
+		}
+		b := tx.Bucket([]byte(addressesBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			ar := service.AddressRecord{}
+			if er := ar.FromBytes(v); er != nil {
+				return fmt.Errorf("invalid record of address %s: %w", k, er)
+			}
+			return nil
+		})
+	})
+	if er != nil {
+		if errors.Is(er, ErrSchemaTooNew) {
+			return version, er
+		}
+		return version, fmt.Errorf("%w: %s", ErrInvalidSnapshot, er)
+	}
+	return version, nil
+}
+
+// Restore replaces the data file at path with a copy of snapshot, after validating it. The current data file, if
+// any, is first copied to a backup file next to it. The server must not be running, nor be started until it returns.
+func Restore(snapshot, path string) (RestoreResult, error) {
+	res := RestoreResult{}
+	var er error
+	res.Version, er = ValidateSnapshot(snapshot)
+	if er != nil {
+		return res, er
+	}
+
+	if _, er = os.Stat(path); errors.Is(er, os.ErrNotExist) {
+		return res, copySnapshot(snapshot, path)
+	}
+
+	// opening the data file fails if a running server holds it. That is only a check: the lock is on the file being
+	// replaced, so a server started before Restore returns may open either file.
+	db, er := OpenDataStore(path)
+	if er != nil {
+		return res, er
+	}
+	defer db.Close()
+
+	er = db.View(func(tx *bolt.Tx) error {
+		if isEmpty(tx) {
+			return nil
+		}
+		res.Backup = fmt.Sprintf("%s.pre-restore-%s.bak", path, time.Now().Format("20060102150405"))
+		return tx.CopyFile(res.Backup, 0600)
+	})
+	if er != nil {
+		return res, fmt.Errorf("failed to backup the data file before restoring: %w", er)
+	}
+	return res, copySnapshot(snapshot, path)
+}
+
+// copySnapshot copies snapshot to a temporary file next to path and then renames it to path, so path is never left
+// half written
+func copySnapshot(snapshot, path string) error {
+	src, er := os.Open(snapshot)
+	if er != nil {
+		return er
+	}
+	defer src.Close()
+
+	tmp, er := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".restore-*")
+	if er != nil {
+		return er
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, er = io.Copy(tmp, src); er != nil {
+		_ = tmp.Close()
+		return er
+	}
+	if er = tmp.Sync(); er != nil {
+		_ = tmp.Close()
+		return er
+	}
+	if er = tmp.Close(); er != nil {
+		return er
+	}
+	if er = os.Chmod(tmp.Name(), 0600); er != nil {
+		return er
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// isEmpty tells if the data file has no bucket at all, as a new one
+func isEmpty(tx *bolt.Tx) bool {
+	empty := true
+	_ = tx.ForEach(func(_ []byte, _ *bolt.Bucket) error {
+		empty = false
+		return nil
+	})
+	return empty
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ = Describe("Backup", func() {
+	var snapshot string
+	ds := withTempDataStore()
+
+	BeforeEach(func() {
+		snapshot = filepath.Join(ds.dir, "snapshot.dat")
+		_, er := Migrate(ds.db, ds.path, false)
+		Expect(er).To(BeNil())
+	})
+
+	writeSnapshot := func() {
+		Expect(ds.db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(snapshot, 0600)
+		})).To(Succeed())
+	}
+
+	It("Should validate a snapshot", func() {
+		writeSnapshot()
+		version, er := ValidateSnapshot(snapshot)
+		Expect(er).To(BeNil())
+		Expect(version).To(Equal(SchemaVersion))
+	})
+
+	It("Should refuse a file that is not a data file", func() {
+		Expect(os.WriteFile(snapshot, []byte("not a bolt file"), 0600)).To(Succeed())
+		_, er := ValidateSnapshot(snapshot)
+		Expect(er).To(MatchError(ErrInvalidSnapshot))
+	})
+
+	It("Should refuse a snapshot with an invalid address record", func() {
+		Expect(NewAddressStore(ds.db).Put("addr", []byte("record"))).To(Succeed())
+		writeSnapshot()
+		_, er := ValidateSnapshot(snapshot)
+		Expect(er).To(MatchError(ErrInvalidSnapshot))
+	})
+
+	It("Should refuse a snapshot of a newer schema", func() {
+		Expect(ds.db.Update(func(tx *bolt.Tx) error {
+			return writeSchemaVersion(tx, SchemaVersion+1)
+		})).To(Succeed())
+		writeSnapshot()
+		_, er := ValidateSnapshot(snapshot)
+		Expect(er).To(MatchError(ErrSchemaTooNew))
+	})
+
+	It("Should restore a snapshot keeping a backup of the data file", func() {
+		writeSnapshot()
+		secret, er := LoadOrCreateSecret(ds.db)
+		Expect(er).To(BeNil())
+		Expect(ds.db.Close()).To(Succeed())
+
+		res, er := Restore(snapshot, ds.path)
+		Expect(er).To(BeNil())
+		Expect(res.Version).To(Equal(SchemaVersion))
+		Expect(res.Backup).NotTo(BeEmpty())
+
+		secretOf := func(path string) []byte {
+			restored, er := bolt.Open(path, 0600, nil)
+			Expect(er).To(BeNil())
+			defer restored.Close()
+			var value []byte
+			Expect(restored.View(func(tx *bolt.Tx) error {
+				value = append(value, tx.Bucket([]byte(settingsBucket)).Get([]byte(secretKey))...)
+				return nil
+			})).To(Succeed())
+			return value
+		}
+		Expect(secretOf(ds.path)).To(BeNil())
+		Expect(secretOf(res.Backup)).To(Equal([]byte(secret)))
+
+		ds.db, er = OpenDataStore(ds.path)
+		Expect(er).To(BeNil())
+	})
+
+	It("Should not restore while the data file is in use", func() {
+		writeSnapshot()
+		_, er := Restore(snapshot, ds.path)
+		Expect(er).NotTo(BeNil())
+	})
+})
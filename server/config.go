@@ -0,0 +1,293 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/msaldanha/pulpit/server/rest"
+)
+
+const (
+	envPrefix       = "PULPIT_"
+	legacySecretEnv = "SERVER_SECRET"
+)
+
+var validLogLevels = []string{"debug", "info", "warn", "error", "fatal"}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		Url:             ":8080",
+		DataStore:       "8080.dat",
+		IpfsPort:        "4001",
+		IpfsApiPort:     "5002",
+		IpfsGatewayPort: "8088",
+		IpfsMdns:        true,
+		LogLevel:        "info",
+		CorsOrigins:     []string{"*"},
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     2 * time.Minute,
+		MediaTimeout:    5 * time.Second,
+		ShutdownTimeout: 10 * time.Second,
+		TokenTTL:        15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		KeyIdleTimeout:  15 * time.Minute,
+		LoginRate:       "10/1m",
+		AddressRate:     "5/1h",
+		PostRate:        "60/1m",
+		MediaRate:       "20/1m",
+		LoginAttempts:   5,
+		LoginLockout:    time.Minute,
+		LoginLockoutMax: time.Hour,
+	}
+}
+
+// LoadOptions builds the server options from (in increasing order of precedence) the defaults, the config file
+// given by -config, the PULPIT_* environment variables and the command line flags.
+func LoadOptions(args []string) (Options, error) {
+	opts := DefaultOptions()
+
+	flagged := Options{}
+	fs := flag.NewFlagSet("pulpit", flag.ContinueOnError)
+	configFile := fs.String("config", "", "Config file (TOML)")
+	registerFlags(fs, &flagged, opts)
+	if er := fs.Parse(args); er != nil {
+		return Options{}, er
+	}
+
+	if *configFile != "" {
+		if _, er := toml.DecodeFile(*configFile, &opts); er != nil {
+			return Options{}, fmt.Errorf("failed to read config file %s: %w", *configFile, er)
+		}
+	}
+
+	if er := applyEnv(&opts, os.LookupEnv); er != nil {
+		return Options{}, er
+	}
+
+	applyFlags(fs, &opts, &flagged)
+
+	if er := opts.Validate(); er != nil {
+		return Options{}, er
+	}
+
+	return opts, nil
+}
+
+// Validate checks that the options are usable
+func (o Options) Validate() error {
+	if o.Url == "" && o.UnixSocket == "" {
+		return fmt.Errorf("%w: url and unix_socket cannot be both empty", ErrInvalidOptions)
+	}
+	if (o.TLSCert == "") != (o.TLSKey == "") {
+		return fmt.Errorf("%w: tls_cert and tls_key must be given together", ErrInvalidOptions)
+	}
+	if o.TLSCert != "" && o.TLSSelfSigned {
+		return fmt.Errorf("%w: tls_cert and tls_self_signed cannot be used together", ErrInvalidOptions)
+	}
+	if o.DataStore == "" {
+		return fmt.Errorf("%w: data cannot be empty", ErrInvalidOptions)
+	}
+	ports := map[string]string{
+		"ipfs_port":         o.IpfsPort,
+		"ipfs_api_port":     o.IpfsApiPort,
+		"ipfs_gateway_port": o.IpfsGatewayPort,
+	}
+	for name, port := range ports {
+		p, er := strconv.Atoi(port)
+		if er != nil || p < 0 || p > 65535 {
+			return fmt.Errorf("%w: %s must be a port number, got %q", ErrInvalidOptions, name, port)
+		}
+	}
+	if !isValidLogLevel(o.LogLevel) {
+		return fmt.Errorf("%w: log_level must be one of %s, got %q", ErrInvalidOptions,
+			strings.Join(validLogLevels, ", "), o.LogLevel)
+	}
+	timeouts := map[string]time.Duration{
+		"read_timeout":     o.ReadTimeout,
+		"write_timeout":    o.WriteTimeout,
+		"idle_timeout":     o.IdleTimeout,
+		"media_timeout":    o.MediaTimeout,
+		"shutdown_timeout": o.ShutdownTimeout,
+		"key_idle_timeout": o.KeyIdleTimeout,
+	}
+	for name, t := range timeouts {
+		if t < 0 {
+			return fmt.Errorf("%w: %s cannot be negative", ErrInvalidOptions, name)
+		}
+	}
+	ttls := map[string]time.Duration{
+		"token_ttl":         o.TokenTTL,
+		"refresh_token_ttl": o.RefreshTokenTTL,
+	}
+	for name, t := range ttls {
+		if t <= 0 {
+			return fmt.Errorf("%w: %s must be positive", ErrInvalidOptions, name)
+		}
+	}
+	rates := map[string]string{
+		"login_rate":   o.LoginRate,
+		"address_rate": o.AddressRate,
+		"post_rate":    o.PostRate,
+		"media_rate":   o.MediaRate,
+	}
+	for name, r := range rates {
+		if _, er := rest.ParseRateLimit(r); er != nil {
+			return fmt.Errorf("%w: %s: %s", ErrInvalidOptions, name, er)
+		}
+	}
+	if o.LoginAttempts < 0 {
+		return fmt.Errorf("%w: login_attempts cannot be negative", ErrInvalidOptions)
+	}
+	if o.LoginAttempts > 0 && (o.LoginLockout <= 0 || o.LoginLockoutMax < o.LoginLockout) {
+		return fmt.Errorf("%w: login_lockout must be positive and not greater than login_lockout_max", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// rateLimit returns the rate limit r, already checked by Validate
+func rateLimit(r string) rest.RateLimit {
+	l, _ := rest.ParseRateLimit(r)
+	return l
+}
+
+func isValidLogLevel(level string) bool {
+	for _, l := range validLogLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// registerFlags registers a flag for every Options field having a flag tag. Parsed values are stored in target
+// so that only the flags actually given on the command line override the other sources.
+func registerFlags(fs *flag.FlagSet, target *Options, defaults Options) {
+	t := reflect.TypeOf(*target)
+	v := reflect.ValueOf(target).Elem()
+	d := reflect.ValueOf(defaults)
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("flag")
+		if name == "" {
+			continue
+		}
+		usage := t.Field(i).Tag.Get("usage")
+		switch p := v.Field(i).Addr().Interface().(type) {
+		case *string:
+			fs.StringVar(p, name, d.Field(i).String(), usage)
+		case *bool:
+			fs.BoolVar(p, name, d.Field(i).Bool(), usage)
+		case *int:
+			fs.IntVar(p, name, int(d.Field(i).Int()), usage)
+		case *time.Duration:
+			fs.DurationVar(p, name, time.Duration(d.Field(i).Int()), usage)
+		default:
+			v.Field(i).Set(d.Field(i))
+			fs.Var(&listValue{v: v.Field(i)}, name, usage)
+		}
+	}
+}
+
+func applyFlags(fs *flag.FlagSet, opts *Options, flagged *Options) {
+	t := reflect.TypeOf(*opts)
+	v := reflect.ValueOf(opts).Elem()
+	f := reflect.ValueOf(flagged).Elem()
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+	for i := 0; i < t.NumField(); i++ {
+		if set[t.Field(i).Tag.Get("flag")] {
+			v.Field(i).Set(f.Field(i))
+		}
+	}
+}
+
+func applyEnv(opts *Options, lookup func(string) (string, bool)) error {
+	if secret, found := lookup(legacySecretEnv); found {
+		opts.Secret = secret
+	}
+
+	t := reflect.TypeOf(*opts)
+	v := reflect.ValueOf(opts).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("toml")
+		if key == "" {
+			continue
+		}
+		name := envPrefix + strings.ToUpper(key)
+		value, found := lookup(name)
+		if !found {
+			continue
+		}
+		if er := setField(v.Field(i), value); er != nil {
+			return fmt.Errorf("%w: invalid value for %s: %s", ErrInvalidOptions, name, er)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case bool:
+		b, er := strconv.ParseBool(value)
+		if er != nil {
+			return er
+		}
+		field.SetBool(b)
+	case int:
+		n, er := strconv.Atoi(value)
+		if er != nil {
+			return er
+		}
+		field.SetInt(int64(n))
+	case time.Duration:
+		d, er := time.ParseDuration(value)
+		if er != nil {
+			return er
+		}
+		field.SetInt(int64(d))
+	case []string:
+		field.Set(reflect.ValueOf(splitList(value)))
+	default:
+		return fmt.Errorf("unsupported option type %s", field.Type())
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// listValue adapts a []string Options field to flag.Value
+type listValue struct {
+	v reflect.Value
+}
+
+func (l *listValue) String() string {
+	if !l.v.IsValid() {
+		return ""
+	}
+	return strings.Join(l.v.Interface().([]string), ",")
+}
+
+func (l *listValue) Set(value string) error {
+	return setField(l.v, value)
+}
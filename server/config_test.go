@@ -0,0 +1,119 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/pulpit/server/rest"
+)
+
+var _ = Describe("LoadOptions", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var er error
+		dir, er = os.MkdirTemp("", "pulpit-config")
+		Expect(er).To(BeNil())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	writeConfig := func(content string) string {
+		file := filepath.Join(dir, "pulpit.toml")
+		Expect(os.WriteFile(file, []byte(content), 0600)).To(Succeed())
+		return file
+	}
+
+	It("Should use the defaults when nothing is given", func() {
+		opts, er := LoadOptions(nil)
+		Expect(er).To(BeNil())
+		Expect(opts).To(Equal(DefaultOptions()))
+	})
+
+	It("Should apply file, env and flags in order of precedence", func() {
+		file := writeConfig(`
+url = ":9000"
+data = "file.dat"
+log_level = "debug"
+read_timeout = "10s"
+ipfs_bootstrap = ["/ip4/127.0.0.1/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"]
+`)
+		os.Setenv("PULPIT_DATA", "env.dat")
+		os.Setenv("PULPIT_LOG_LEVEL", "warn")
+		defer os.Unsetenv("PULPIT_DATA")
+		defer os.Unsetenv("PULPIT_LOG_LEVEL")
+
+		opts, er := LoadOptions([]string{"-config", file, "-loglevel", "error", "-ipfslan"})
+		Expect(er).To(BeNil())
+		Expect(opts.Url).To(Equal(":9000"))
+		Expect(opts.DataStore).To(Equal("env.dat"))
+		Expect(opts.LogLevel).To(Equal("error"))
+		Expect(opts.ReadTimeout).To(Equal(10 * time.Second))
+		Expect(opts.IpfsBootstrap).To(HaveLen(1))
+		Expect(opts.IpfsLanMode).To(BeTrue())
+		Expect(opts.IpfsMdns).To(BeTrue())
+	})
+
+	It("Should read the secret from the environment", func() {
+		os.Setenv("SERVER_SECRET", "legacy")
+		defer os.Unsetenv("SERVER_SECRET")
+		opts, er := LoadOptions(nil)
+		Expect(er).To(BeNil())
+		Expect(opts.Secret).To(Equal("legacy"))
+
+		os.Setenv("PULPIT_SECRET", "new")
+		defer os.Unsetenv("PULPIT_SECRET")
+		opts, er = LoadOptions(nil)
+		Expect(er).To(BeNil())
+		Expect(opts.Secret).To(Equal("new"))
+	})
+
+	It("Should parse list flags", func() {
+		opts, er := LoadOptions([]string{"-corsorigins", "http://a.com, http://b.com"})
+		Expect(er).To(BeNil())
+		Expect(opts.CorsOrigins).To(Equal([]string{"http://a.com", "http://b.com"}))
+	})
+
+	It("Should reject invalid options", func() {
+		_, er := LoadOptions([]string{"-ipfsport", "abc"})
+		Expect(er).To(MatchError(ErrInvalidOptions))
+
+		_, er = LoadOptions([]string{"-loglevel", "verbose"})
+		Expect(er).To(MatchError(ErrInvalidOptions))
+
+		_, er = LoadOptions([]string{"-readtimeout", "-1s"})
+		Expect(er).To(MatchError(ErrInvalidOptions))
+
+		_, er = LoadOptions([]string{"-loginrate", "10"})
+		Expect(er).To(MatchError(ErrInvalidOptions))
+
+		_, er = LoadOptions([]string{"-loginattempts", "3", "-loginlockout", "2h"})
+		Expect(er).To(MatchError(ErrInvalidOptions))
+
+		os.Setenv("PULPIT_IPFS_LAN", "maybe")
+		defer os.Unsetenv("PULPIT_IPFS_LAN")
+		_, er = LoadOptions(nil)
+		Expect(er).To(MatchError(ErrInvalidOptions))
+	})
+
+	It("Should parse rate limits and int options", func() {
+		os.Setenv("PULPIT_LOGIN_ATTEMPTS", "0")
+		defer os.Unsetenv("PULPIT_LOGIN_ATTEMPTS")
+		opts, er := LoadOptions([]string{"-postrate", "", "-mediarate", "3/10s"})
+		Expect(er).To(BeNil())
+		Expect(opts.LoginAttempts).To(Equal(0))
+		Expect(rateLimit(opts.PostRate)).To(Equal(rest.RateLimit{}))
+		Expect(rateLimit(opts.MediaRate)).To(Equal(rest.RateLimit{Count: 3, Period: 10 * time.Second}))
+	})
+
+	It("Should fail on a missing config file", func() {
+		_, er := LoadOptions([]string{"-config", filepath.Join(dir, "missing.toml")})
+		Expect(er).NotTo(BeNil())
+	})
+})
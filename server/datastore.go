@@ -0,0 +1,70 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+
+	"github.com/msaldanha/pulpit/service"
+)
+
+// OpenDataStore opens (creating if needed) the bolt file holding the addresses and subscriptions
+func OpenDataStore(path string) (*bolt.DB, error) {
+	db, er := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if errors.Is(er, berrors.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use by another process: %w", path, er)
+	}
+	return db, er
+}
+
+// NewAddressStore returns the store of the local addresses kept in db
+func NewAddressStore(db *bolt.DB) service.KeyValueStore {
+	return service.NewBoltKeyValueStore(db, addressesBucket)
+}
+
+// NewSubscriptionsStore returns the store of the subscriptions kept in db
+func NewSubscriptionsStore(db *bolt.DB) (*service.SubscriptionsStoreImpl, error) {
+	return service.NewSubscriptionsStore(db, subsBucket)
+}
+
+// NewRevocations returns the store of the revoked tokens kept in db
+func NewRevocations(db *bolt.DB) *service.Revocations {
+	return service.NewRevocations(service.NewBoltKeyValueStore(db, revocationsBucket))
+}
+
+// NewLoginLockout returns the failed logins counters kept in db
+func NewLoginLockout(db *bolt.DB, attempts int, lockout, maxLockout time.Duration) *service.LoginLockout {
+	return service.NewLoginLockout(service.NewBoltKeyValueStore(db, lockoutBucket), attempts, lockout, maxLockout)
+}
+
+// NewApiKeys returns the store of the api keys kept in db
+func NewApiKeys(db *bolt.DB) *service.ApiKeys {
+	return service.NewApiKeys(service.NewBoltKeyValueStore(db, apiKeysBucket))
+}
+
+// LoadOrCreateSecret returns the JWT signing secret kept in db, generating and storing a random one on first use
+func LoadOrCreateSecret(db *bolt.DB) (string, error) {
+	store := service.NewBoltKeyValueStore(db, settingsBucket)
+	value, found, er := store.Get(secretKey)
+	if er != nil {
+		return "", fmt.Errorf("failed to read the jwt secret: %w", er)
+	}
+	if found {
+		return string(value), nil
+	}
+
+	b := make([]byte, secretSize)
+	if _, er = rand.Read(b); er != nil {
+		return "", fmt.Errorf("failed to generate the jwt secret: %w", er)
+	}
+	secret := hex.EncodeToString(b)
+	if er = store.Put(secretKey, []byte(secret)); er != nil {
+		return "", fmt.Errorf("failed to store the jwt secret: %w", er)
+	}
+	return secret, nil
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	bolt "go.etcd.io/bbolt"
+)
+
+// tempDataStore is a data store in its own temporary directory
+type tempDataStore struct {
+	dir  string
+	path string
+	db   *bolt.DB
+}
+
+// withTempDataStore opens a new data store before each spec of the container and removes it after. A spec may
+// close db and open path again.
+func withTempDataStore() *tempDataStore {
+	t := &tempDataStore{}
+	BeforeEach(func() {
+		var er error
+		t.dir, er = os.MkdirTemp("", "pulpit-server")
+		Expect(er).To(BeNil())
+		t.path = filepath.Join(t.dir, "test.dat")
+		t.db, er = OpenDataStore(t.path)
+		Expect(er).To(BeNil())
+	})
+	AfterEach(func() {
+		_ = t.db.Close()
+		_ = os.RemoveAll(t.dir)
+	})
+	return t
+}
+
+var _ = Describe("DataStore", func() {
+	ds := withTempDataStore()
+
+	It("Should generate the jwt secret once and keep it", func() {
+		secret, er := LoadOrCreateSecret(ds.db)
+		Expect(er).To(BeNil())
+		Expect(secret).To(HaveLen(2 * secretSize))
+
+		Expect(ds.db.Close()).To(Succeed())
+		ds.db, er = OpenDataStore(ds.path)
+		Expect(er).To(BeNil())
+		Expect(LoadOrCreateSecret(ds.db)).To(Equal(secret))
+	})
+})
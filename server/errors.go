@@ -0,0 +1,34 @@
+package server
+
+import "errors"
+
+var (
+	ErrInvalidOptions      = errors.New("invalid options")
+	ErrLoggerStartup       = errors.New("failed to setup logger")
+	ErrTLSStartup          = errors.New("failed to setup TLS")
+	ErrIpfsStartup         = errors.New("failed to start IPFS node")
+	ErrEventManagerStartup = errors.New("failed to setup event manager factory")
+	ErrDbStartup           = errors.New("failed to setup DB")
+	ErrMetricsStartup      = errors.New("failed to setup metrics")
+	ErrSchemaTooNew        = errors.New("data file schema is too new")
+	ErrInvalidSnapshot     = errors.New("invalid data file snapshot")
+)
+
+// StartupError is returned by NewServer. Phase is one of the Err*Startup errors and Err is the underlying cause,
+// both can be checked with errors.Is.
+type StartupError struct {
+	Phase error
+	Err   error
+}
+
+func newStartupError(phase, err error) *StartupError {
+	return &StartupError{Phase: phase, Err: err}
+}
+
+func (e *StartupError) Error() string {
+	return e.Phase.Error() + ": " + e.Err.Error()
+}
+
+func (e *StartupError) Unwrap() []error {
+	return []error{e.Phase, e.Err}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/msaldanha/pulpit/service"
+)
+
+const (
+	healthPath         = "/healthz"
+	readyPath          = "/readyz"
+	healthCheckTimeout = 2 * time.Second
+
+	statusOk   = "ok"
+	statusFail = "fail"
+)
+
+type HealthReport struct {
+	Status    string          `json:"status"`
+	Ipfs      IpfsHealth      `json:"ipfs"`
+	PubSub    ComponentHealth `json:"pubsub"`
+	DB        ComponentHealth `json:"db"`
+	Timelines service.Stats   `json:"timelines"`
+}
+
+type ComponentHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type IpfsHealth struct {
+	ComponentHealth
+	Online              bool   `json:"online"`
+	NodeId              string `json:"nodeId,omitempty"`
+	Peers               int    `json:"peers"`
+	BootstrapConfigured int    `json:"bootstrapConfigured"`
+	BootstrapConnected  int    `json:"bootstrapConnected"`
+}
+
+func (s *Server) configureHealthHandlers() {
+	s.app.Get(healthPath, s.healthz)
+	s.app.Get(readyPath, s.readyz)
+}
+
+// healthz is the liveness check: fails only if the node cannot work at all (IPFS offline or DB closed)
+func (s *Server) healthz(ctx iris.Context) {
+	report := s.checkHealth(ctx.Request().Context())
+	code := http.StatusOK
+	if report.Ipfs.Status != statusOk || report.DB.Status != statusOk {
+		report.Status = statusFail
+		code = http.StatusServiceUnavailable
+	}
+	ctx.StatusCode(code)
+	_ = ctx.JSON(report)
+}
+
+// readyz is the readiness check: fails if any component is not working or the server is shutting down
+func (s *Server) readyz(ctx iris.Context) {
+	report := s.checkHealth(ctx.Request().Context())
+	code := http.StatusOK
+	if report.Status != statusOk || s.stopping.Load() {
+		report.Status = statusFail
+		code = http.StatusServiceUnavailable
+	}
+	ctx.StatusCode(code)
+	_ = ctx.JSON(report)
+}
+
+func (s *Server) checkHealth(parent context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(parent, healthCheckTimeout)
+	defer cancel()
+
+	report := HealthReport{
+		Status:    statusOk,
+		Ipfs:      s.checkIpfs(ctx),
+		PubSub:    s.checkPubSub(ctx),
+		DB:        s.checkDB(),
+		Timelines: s.ps.Stats(),
+	}
+	for _, c := range []ComponentHealth{report.Ipfs.ComponentHealth, report.PubSub, report.DB} {
+		if c.Status != statusOk {
+			report.Status = statusFail
+		}
+	}
+	return report
+}
+
+func (s *Server) checkIpfs(ctx context.Context) IpfsHealth {
+	h := IpfsHealth{ComponentHealth: ComponentHealth{Status: statusOk}}
+	h.BootstrapConfigured, h.BootstrapConnected = s.ipfsServer.BootstrapPeers()
+	if s.node == nil || !s.node.IsOnline {
+		h.Status = statusFail
+		h.Error = "node is offline"
+		return h
+	}
+	h.Online = true
+	h.NodeId = s.node.Identity.String()
+	peers, er := s.ipfs.Swarm().Peers(ctx)
+	if er != nil {
+		h.Status = statusFail
+		h.Error = er.Error()
+		return h
+	}
+	h.Peers = len(peers)
+	return h
+}
+
+func (s *Server) checkPubSub(ctx context.Context) ComponentHealth {
+	if s.node == nil || s.node.PubSub == nil {
+		return ComponentHealth{Status: statusFail, Error: "pubsub is disabled"}
+	}
+	if _, er := s.ipfs.PubSub().Ls(ctx); er != nil {
+		return ComponentHealth{Status: statusFail, Error: er.Error()}
+	}
+	return ComponentHealth{Status: statusOk}
+}
+
+func (s *Server) checkDB() ComponentHealth {
+	er := s.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+	if er != nil {
+		return ComponentHealth{Status: statusFail, Error: er.Error()}
+	}
+	return ComponentHealth{Status: statusOk}
+}
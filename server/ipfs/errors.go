@@ -0,0 +1,8 @@
+package ipfs
+
+import "errors"
+
+var (
+	ErrRepoPathNotSet = errors.New("ipfs repo path not set")
+	ErrRepoLocked     = errors.New("ipfs repo is locked by another process")
+)
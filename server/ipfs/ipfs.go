@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/core"
@@ -19,15 +21,51 @@ import (
 	"go.uber.org/zap"
 )
 
+// DefaultBootstrapPeers is used when no bootstrap peers are configured and the node is not in LAN mode
+var DefaultBootstrapPeers = []string{
+	// IPFS Bootstrapper nodes.
+	"/dnsaddr/bootstrap.libp2p.io/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN",
+	"/dnsaddr/bootstrap.libp2p.io/p2p/QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa",
+	"/dnsaddr/bootstrap.libp2p.io/p2p/QmbLHAnMoJPWSCR5Zhtx6BHJX9KiKNN6tpvbUcqanj75Nb",
+	"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
+	"/ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
+
+	// IPFS Cluster Pinning nodes
+	"/ip4/138.201.67.219/tcp/4001/p2p/QmUd6zHcbkbcs7SMxwLs48qZVX3vpcM8errYS7xEczwRMA",
+	"/ip4/138.201.67.220/tcp/4001/p2p/QmNSYxZAiJHeLdkBg38roksAR9So7Y5eojks1yjEcUtZ7i",
+	"/ip4/138.201.68.74/tcp/4001/p2p/QmdnXwLrC8p1ueiq2Qya8joNvk3TVVDAut7PrikmZwubtR",
+	"/ip4/94.130.135.167/tcp/4001/p2p/QmUEMvxS2e7iDrereVYc5SWPauXPyNwxcy9BXZrC1QTcHE",
+}
+
+var (
+	// plugins can only be injected once per process
+	pluginsOnce sync.Once
+	pluginsErr  error
+)
+
 type ServerOptions struct {
 	IpfsPort        string
 	IpfsApiPort     string
 	IpfsGatewayPort string
+	RepoPath        string
+	// Bootstrap peers to connect to. If empty, DefaultBootstrapPeers is used unless LanMode is set.
+	Bootstrap []string
+	// Swarm listening addresses. If empty, all interfaces are used on IpfsPort.
+	SwarmAddrs    []string
+	AnnounceAddrs []string
+	// LanMode restricts the node to the explicitly listed peers (and mDNS, if enabled). No public
+	// bootstrap nodes, NAT traversal or relays are used.
+	LanMode bool
+	Mdns    bool
 }
 
 type IpfsServer struct {
-	logger *zap.Logger
-	opts   ServerOptions
+	logger   *zap.Logger
+	opts     ServerOptions
+	node     *core.IpfsNode
+	tempRepo string
+	// number of bootstrap peers reached by connectToPeers
+	bootstrapConnected atomic.Int32
 }
 
 func NewIpfsServer(logger *zap.Logger, opts ServerOptions) *IpfsServer {
@@ -48,19 +86,63 @@ func (s *IpfsServer) SpawnEphemeral(ctx context.Context) (*core.IpfsNode, error)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp repo: %s", err)
 	}
+	s.tempRepo = repoPath
 
 	// Spawning an ephemeral IPFS node
 	return s.createNode(ctx, repoPath)
 }
 
+// Spawns a node backed by the repo at RepoPath. The repo is initialized on the first run and reused afterwards,
+// keeping the node identity and the blockstore across restarts.
+func (s *IpfsServer) SpawnPersistent(ctx context.Context) (*core.IpfsNode, error) {
+	if s.opts.RepoPath == "" {
+		return nil, ErrRepoPathNotSet
+	}
+
+	if err := s.setupPlugins(""); err != nil {
+		return nil, err
+	}
+
+	repoPath, err := s.initRepo(s.opts.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createNode(ctx, repoPath)
+}
+
 // Creates an IPFS node and returns its coreAPI
 func (s *IpfsServer) createNode(ctx context.Context, repoPath string) (*core.IpfsNode, error) {
+	if _, err := config.ParseBootstrapPeers(s.bootstrapPeers()); err != nil {
+		return nil, fmt.Errorf("invalid bootstrap peers: %w", err)
+	}
+
+	locked, err := fsrepo.LockedByOtherProcess(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check repo lock: %w", err)
+	}
+	if locked {
+		return nil, fmt.Errorf("%w: %s", ErrRepoLocked, repoPath)
+	}
+
 	// Open the repo
 	repo, err := fsrepo.Open(repoPath)
 	if err != nil {
 		return nil, err
 	}
 
+	// Options may have changed since the repo was created
+	cfg, err := repo.Config()
+	if err != nil {
+		_ = repo.Close()
+		return nil, err
+	}
+	s.applyConfig(cfg)
+	if err = repo.SetConfig(cfg); err != nil {
+		_ = repo.Close()
+		return nil, err
+	}
+
 	// Construct the node
 
 	nodeOptions := &core.BuildCfg{
@@ -78,44 +160,55 @@ func (s *IpfsServer) createNode(ctx context.Context, repoPath string) (*core.Ipf
 
 	node, err := core.NewNode(ctx, nodeOptions)
 	if err != nil {
+		_ = repo.Close()
 		return nil, err
 	}
 
-	s.logger.Info("IPFS: repo created", zap.String("repo_path", repoPath),
+	s.logger.Info("IPFS: node created", zap.String("repo_path", repoPath), zap.String("node_id", node.Identity.String()),
 		zap.Bool("is_online", node.IsOnline), zap.Bool("is_daemon", node.IsDaemon))
 
-	bootstrapNodes := []string{
-		// IPFS Bootstrapper nodes.
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN",
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa",
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmbLHAnMoJPWSCR5Zhtx6BHJX9KiKNN6tpvbUcqanj75Nb",
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
-		"/ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
-		// "/ip4/127.0.0.1/tcp/4002/ipfs/QmNvxM73kCkkGvvjL4cjq2jKsLhebcxy4qxyUxHFfJEpXL",
-
-		// IPFS Cluster Pinning nodes
-		"/ip4/138.201.67.219/tcp/4001/p2p/QmUd6zHcbkbcs7SMxwLs48qZVX3vpcM8errYS7xEczwRMA",
-		"/ip4/138.201.67.220/tcp/4001/p2p/QmNSYxZAiJHeLdkBg38roksAR9So7Y5eojks1yjEcUtZ7i",
-		"/ip4/138.201.68.74/tcp/4001/p2p/QmdnXwLrC8p1ueiq2Qya8joNvk3TVVDAut7PrikmZwubtR",
-		"/ip4/94.130.135.167/tcp/4001/p2p/QmUEMvxS2e7iDrereVYc5SWPauXPyNwxcy9BXZrC1QTcHE",
-
-		// You can add more nodes here, for example, another IPFS node you might have running locally, mine was:
-		// "/ip4/127.0.0.1/tcp/4010/p2p/QmZp2fhDLxjYue2RiUvLwT9MWdnbDxam32qYFnGmxZDh5L",
-	}
-
 	// Attach the Core API to the node
 	ipfs, err := coreapi.NewCoreAPI(node)
 	if err != nil {
-		s.logger.Error("IPFS: failed to get ipfs api", zap.Error(err))
-		panic(fmt.Errorf("IPFS: failed to get ipfs api: %s", err))
+		_ = node.Close()
+		return nil, fmt.Errorf("failed to get ipfs api: %w", err)
 	}
 
-	go s.connectToPeers(ctx, ipfs, bootstrapNodes)
+	s.node = node
+	go s.connectToPeers(ctx, ipfs, s.bootstrapPeers())
 
 	return node, err
 }
 
+// BootstrapPeers returns the number of configured bootstrap peers and how many of them were reached
+func (s *IpfsServer) BootstrapPeers() (configured, connected int) {
+	return len(s.bootstrapPeers()), int(s.bootstrapConnected.Load())
+}
+
+// Stop closes the spawned node and, for ephemeral nodes, removes the temporary repo
+func (s *IpfsServer) Stop() error {
+	var err error
+	if s.node != nil {
+		err = s.node.Close()
+		s.node = nil
+	}
+	if s.tempRepo != "" {
+		if er := os.RemoveAll(s.tempRepo); er != nil && err == nil {
+			err = er
+		}
+		s.tempRepo = ""
+	}
+	return err
+}
+
 func (s *IpfsServer) setupPlugins(externalPluginsPath string) error {
+	pluginsOnce.Do(func() {
+		pluginsErr = s.loadPlugins(externalPluginsPath)
+	})
+	return pluginsErr
+}
+
+func (s *IpfsServer) loadPlugins(externalPluginsPath string) error {
 	// Load any external plugins if available on externalPluginsPath
 	plugins, err := loader.NewPluginLoader(filepath.Join(externalPluginsPath, "plugins"))
 	if err != nil {
@@ -145,7 +238,7 @@ func (s *IpfsServer) createTempRepo(ctx context.Context) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	cfg.Addresses = s.addressesConfig()
+	s.applyConfig(cfg)
 
 	s.logger.Info("nodeID: %s", zap.String("node_id", cfg.Identity.PeerID))
 
@@ -158,20 +251,86 @@ func (s *IpfsServer) createTempRepo(ctx context.Context) (string, error) {
 	return repoPath, nil
 }
 
+func (s *IpfsServer) initRepo(repoPath string) (string, error) {
+	repoPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid repo path: %s", err)
+	}
+
+	if fsrepo.IsInitialized(repoPath) {
+		s.logger.Info("reusing existing repo", zap.String("repo_path", repoPath))
+		return repoPath, nil
+	}
+
+	err = os.MkdirAll(repoPath, 0700)
+	if err != nil {
+		return "", fmt.Errorf("failed to create repo dir: %s", err)
+	}
+
+	cfg, err := config.Init(ioutil.Discard, 2048)
+	if err != nil {
+		return "", err
+	}
+	s.applyConfig(cfg)
+
+	s.logger.Info("initializing repo", zap.String("repo_path", repoPath), zap.String("node_id", cfg.Identity.PeerID))
+
+	err = fsrepo.Init(repoPath, cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to init repo: %s", err)
+	}
+
+	return repoPath, nil
+}
+
+func (s *IpfsServer) applyConfig(cfg *config.Config) {
+	cfg.Addresses = s.addressesConfig()
+	cfg.Bootstrap = s.bootstrapPeers()
+	cfg.Discovery.MDNS.Enabled = s.opts.Mdns
+
+	if s.opts.LanMode {
+		cfg.Swarm.DisableNatPortMap = true
+		cfg.Swarm.RelayClient.Enabled = config.False
+		cfg.Swarm.RelayService.Enabled = config.False
+		cfg.Swarm.EnableHolePunching = config.False
+		cfg.AutoNAT.ServiceMode = config.AutoNATServiceDisabled
+		cfg.Routing.LoopbackAddressesOnLanDHT = config.True
+	}
+}
+
 func (s *IpfsServer) addressesConfig() config.Addresses {
-	return config.Addresses{
-		Swarm: []string{
+	swarm := s.opts.SwarmAddrs
+	if len(swarm) == 0 {
+		swarm = []string{
 			"/ip4/0.0.0.0/tcp/" + s.opts.IpfsPort,
 			// "/ip4/0.0.0.0/udp/4002/utp", // disabled for now.
 			"/ip6/::/tcp/" + s.opts.IpfsPort,
-		},
-		Announce:   []string{},
+		}
+	}
+	announce := s.opts.AnnounceAddrs
+	if announce == nil {
+		announce = []string{}
+	}
+	return config.Addresses{
+		Swarm:      swarm,
+		Announce:   announce,
 		NoAnnounce: []string{},
 		API:        config.Strings{"/ip4/127.0.0.1/tcp/" + s.opts.IpfsApiPort},
 		Gateway:    config.Strings{"/ip4/127.0.0.1/tcp/" + s.opts.IpfsGatewayPort},
 	}
 }
 
+func (s *IpfsServer) bootstrapPeers() []string {
+	if len(s.opts.Bootstrap) > 0 || s.opts.LanMode {
+		peers := make([]string, len(s.opts.Bootstrap))
+		copy(peers, s.opts.Bootstrap)
+		return peers
+	}
+	peers := make([]string, len(DefaultBootstrapPeers))
+	copy(peers, DefaultBootstrapPeers)
+	return peers
+}
+
 func (s *IpfsServer) connectToPeers(ctx context.Context, ipfs icore.CoreAPI, peers []string) error {
 	var wg sync.WaitGroup
 	peerInfos := make(map[peer.ID]*peer.AddrInfo, len(peers))
@@ -200,6 +359,7 @@ func (s *IpfsServer) connectToPeers(ctx context.Context, ipfs icore.CoreAPI, pee
 			if err != nil {
 				s.logger.Warn("failed to connect", zap.String("peer_id", peerInfo.ID.String()), zap.Error(err))
 			} else {
+				s.bootstrapConnected.Add(1)
 				s.logger.Warn("connected", zap.String("peer_id", peerInfo.ID.String()))
 			}
 		}(*peerInfo)
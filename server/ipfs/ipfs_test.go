@@ -0,0 +1,103 @@
+package ipfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/repo/fsrepo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("IpfsServer", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var er error
+		dir, er = os.MkdirTemp("", "pulpit-ipfs")
+		Expect(er).To(BeNil())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("Should need a repo path to spawn a persistent node", func() {
+		s := NewIpfsServer(zap.NewNop(), ServerOptions{})
+		_, er := s.SpawnPersistent(context.Background())
+		Expect(er).To(MatchError(ErrRepoPathNotSet))
+	})
+
+	It("Should initialize the repo once and keep its identity", func() {
+		s := NewIpfsServer(zap.NewNop(), ServerOptions{IpfsPort: "0", IpfsApiPort: "0", IpfsGatewayPort: "0"})
+		Expect(s.setupPlugins("")).To(Succeed())
+
+		repoPath := filepath.Join(dir, "repo")
+		path, er := s.initRepo(repoPath)
+		Expect(er).To(BeNil())
+		Expect(fsrepo.IsInitialized(path)).To(BeTrue())
+		peerId := func(path string) string {
+			repo, er := fsrepo.Open(path)
+			Expect(er).To(BeNil())
+			defer repo.Close()
+			cfg, er := repo.Config()
+			Expect(er).To(BeNil())
+			return cfg.Identity.PeerID
+		}
+		id := peerId(path)
+		Expect(id).NotTo(BeEmpty())
+
+		path, er = s.initRepo(repoPath)
+		Expect(er).To(BeNil())
+		Expect(peerId(path)).To(Equal(id))
+	})
+
+	Context("config", func() {
+		const peer = "/ip4/192.168.0.2/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+
+		It("Should bootstrap from the public nodes unless peers are given or the node is in LAN mode", func() {
+			cfg := &config.Config{}
+			NewIpfsServer(zap.NewNop(), ServerOptions{}).applyConfig(cfg)
+			Expect(cfg.Bootstrap).To(Equal(DefaultBootstrapPeers))
+
+			cfg = &config.Config{}
+			NewIpfsServer(zap.NewNop(), ServerOptions{Bootstrap: []string{peer}}).applyConfig(cfg)
+			Expect(cfg.Bootstrap).To(Equal([]string{peer}))
+
+			cfg = &config.Config{}
+			NewIpfsServer(zap.NewNop(), ServerOptions{LanMode: true}).applyConfig(cfg)
+			Expect(cfg.Bootstrap).To(BeEmpty())
+		})
+
+		It("Should turn off NAT traversal and relays in LAN mode", func() {
+			cfg := &config.Config{}
+			NewIpfsServer(zap.NewNop(), ServerOptions{LanMode: true, Mdns: true}).applyConfig(cfg)
+			Expect(cfg.Discovery.MDNS.Enabled).To(BeTrue())
+			Expect(cfg.Swarm.DisableNatPortMap).To(BeTrue())
+			Expect(cfg.Swarm.RelayClient.Enabled.WithDefault(true)).To(BeFalse())
+			Expect(cfg.Swarm.RelayService.Enabled.WithDefault(true)).To(BeFalse())
+			Expect(cfg.Swarm.EnableHolePunching.WithDefault(true)).To(BeFalse())
+			Expect(cfg.AutoNAT.ServiceMode).To(Equal(config.AutoNATServiceDisabled))
+		})
+
+		It("Should listen on the given swarm addresses or on all the interfaces", func() {
+			addrs := NewIpfsServer(zap.NewNop(), ServerOptions{IpfsPort: "4005"}).addressesConfig()
+			Expect(addrs.Swarm).To(Equal([]string{"/ip4/0.0.0.0/tcp/4005", "/ip6/::/tcp/4005"}))
+
+			swarm := []string{"/ip4/192.168.0.1/tcp/4005"}
+			addrs = NewIpfsServer(zap.NewNop(), ServerOptions{SwarmAddrs: swarm, AnnounceAddrs: swarm}).addressesConfig()
+			Expect(addrs.Swarm).To(Equal(swarm))
+			Expect(addrs.Announce).To(Equal(swarm))
+		})
+
+		It("Should refuse invalid bootstrap peers before opening the repo", func() {
+			s := NewIpfsServer(zap.NewNop(), ServerOptions{Bootstrap: []string{"not a multiaddr"}})
+			_, er := s.createNode(context.Background(), filepath.Join(dir, "none"))
+			Expect(er).NotTo(BeNil())
+			Expect(er.Error()).To(ContainSubstring("invalid bootstrap peers"))
+		})
+	})
+})
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// loadTLSConfig returns the TLS config for the TCP listener, or nil if TLS is not enabled
+func loadTLSConfig(opts Options, logger *zap.Logger) (*tls.Config, error) {
+	var cert tls.Certificate
+	var er error
+	switch {
+	case opts.TLSCert != "":
+		cert, er = tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+	case opts.TLSSelfSigned:
+		logger.Warn("using a self-signed certificate, do not use it in production")
+		cert, er = selfSignedCert(opts.Url)
+	default:
+		return nil, nil
+	}
+	if er != nil {
+		return nil, er
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// selfSignedCert generates a certificate for localhost and for the host in url, if any
+func selfSignedCert(url string) (tls.Certificate, error) {
+	key, er := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if er != nil {
+		return tls.Certificate{}, er
+	}
+	serial, er := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if er != nil {
+		return tls.Certificate{}, er
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"pulpit"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, _, er := net.SplitHostPort(url); er == nil && host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, er := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if er != nil {
+		return tls.Certificate{}, er
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// listen opens the TCP listener (with TLS, if configured) and the unix socket listener, if configured
+func (s *Server) listen() ([]net.Listener, error) {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}
+
+	if s.opts.Url != "" {
+		l, er := net.Listen("tcp", s.opts.Url)
+		if er != nil {
+			return nil, er
+		}
+		if s.tlsConfig != nil {
+			l = tls.NewListener(l, s.tlsConfig)
+		}
+		listeners = append(listeners, l)
+	}
+
+	if s.opts.UnixSocket != "" {
+		l, er := listenUnix(s.opts.UnixSocket)
+		if er != nil {
+			closeAll()
+			return nil, er
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// listenUnix listens on the socket at path, replacing a stale socket file left by a previous run
+func listenUnix(path string) (net.Listener, error) {
+	if fi, er := os.Stat(path); er == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, er := net.Dial("unix", path); er == nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if er := os.Remove(path); er != nil {
+			return nil, er
+		}
+	} else if !errors.Is(er, os.ErrNotExist) {
+		return nil, er
+	}
+
+	l, er := net.Listen("unix", path)
+	if er != nil {
+		return nil, er
+	}
+	if er = os.Chmod(path, 0660); er != nil {
+		_ = l.Close()
+		return nil, er
+	}
+	return l, nil
+}
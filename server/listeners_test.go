@@ -0,0 +1,96 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Listeners", func() {
+	var dir, socket string
+
+	BeforeEach(func() {
+		var er error
+		dir, er = os.MkdirTemp("", "pulpit-listeners")
+		Expect(er).To(BeNil())
+		socket = filepath.Join(dir, "pulpit.sock")
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("Should only enable TLS when a certificate is given or self signed", func() {
+		cfg, er := loadTLSConfig(Options{Url: ":8080"}, zap.NewNop())
+		Expect(er).To(BeNil())
+		Expect(cfg).To(BeNil())
+
+		cfg, er = loadTLSConfig(Options{Url: "pulpit.local:8080", TLSSelfSigned: true}, zap.NewNop())
+		Expect(er).To(BeNil())
+		cert, er := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+		Expect(er).To(BeNil())
+		Expect(cert.VerifyHostname("pulpit.local")).To(Succeed())
+		Expect(cert.VerifyHostname("localhost")).To(Succeed())
+		Expect(cert.VerifyHostname("127.0.0.1")).To(Succeed())
+		Expect(cfg.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+	})
+
+	It("Should serve TLS on the TCP listener and plain HTTP on the unix socket", func() {
+		cfg, er := loadTLSConfig(Options{Url: "127.0.0.1:0", TLSSelfSigned: true}, zap.NewNop())
+		Expect(er).To(BeNil())
+		s := &Server{opts: Options{Url: "127.0.0.1:0", UnixSocket: socket}, tlsConfig: cfg}
+		listeners, er := s.listen()
+		Expect(er).To(BeNil())
+		Expect(listeners).To(HaveLen(2))
+		defer func() {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+		}()
+
+		go func() {
+			defer GinkgoRecover()
+			c, er := listeners[0].Accept()
+			Expect(er).To(BeNil())
+			_ = c.(*tls.Conn).Handshake()
+			_ = c.Close()
+		}()
+		cert, er := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+		Expect(er).To(BeNil())
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+		c, er := tls.Dial("tcp", listeners[0].Addr().String(), &tls.Config{RootCAs: roots})
+		Expect(er).To(BeNil())
+		_ = c.Close()
+
+		fi, er := os.Stat(socket)
+		Expect(er).To(BeNil())
+		Expect(fi.Mode() & os.ModeSocket).NotTo(BeZero())
+		Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0660)))
+	})
+
+	It("Should replace a stale socket but not one in use or another file", func() {
+		l, er := listenUnix(socket)
+		Expect(er).To(BeNil())
+		_, er = listenUnix(socket)
+		Expect(er).To(MatchError(ContainSubstring("in use")))
+
+		// a socket left by a process that did not exit cleanly
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		Expect(l.Close()).To(Succeed())
+		l, er = listenUnix(socket)
+		Expect(er).To(BeNil())
+		Expect(l.Close()).To(Succeed())
+
+		file := filepath.Join(dir, "file")
+		Expect(os.WriteFile(file, nil, 0600)).To(Succeed())
+		_, er = listenUnix(file)
+		Expect(er).To(MatchError(ContainSubstring("is not a socket")))
+	})
+})
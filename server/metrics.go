@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/msaldanha/pulpit/metrics"
+)
+
+const (
+	metricsPath         = "/metrics"
+	metricsPeersTimeout = time.Second
+)
+
+func (s *Server) configureMetrics() error {
+	s.collector = metrics.NewNodeCollector(s.node.Identity.String(), s.nodeStats)
+	if er := prometheus.Register(s.collector); er != nil {
+		return er
+	}
+	s.app.Get(metricsPath, iris.FromStd(promhttp.Handler()))
+	return nil
+}
+
+func (s *Server) nodeStats() metrics.NodeStats {
+	stats := s.ps.Stats()
+	ns := metrics.NodeStats{
+		Logins:             stats.Logins,
+		UnlockedKeys:       stats.UnlockedKeys,
+		Timelines:          stats.Timelines,
+		CompositeTimelines: stats.CompositeTimelines,
+		Subscriptions:      stats.Subscriptions,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), metricsPeersTimeout)
+	defer cancel()
+	if peers, er := s.ipfs.Swarm().Peers(ctx); er == nil {
+		ns.Peers = len(peers)
+	}
+	return ns
+}
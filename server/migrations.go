@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	metaBucket       = "meta"
+	schemaVersionKey = "schema_version"
+)
+
+// Migration is a step changing the data file from the previous schema version to Version. Apply runs in the same
+// transaction that records Version, and must be idempotent.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(tx *bolt.Tx) error
+}
+
+// MigrationResult tells what Migrate did (or would do, on a dry run)
+type MigrationResult struct {
+	From    int
+	To      int
+	Pending []Migration
+	Backup  string
+}
+
+// migrations are the steps to bring a data file to SchemaVersion, in order
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create the buckets of the node stores",
+		Apply: func(tx *bolt.Tx) error {
+			for _, name := range []string{addressesBucket, subsBucket, settingsBucket, revocationsBucket,
+				lockoutBucket, apiKeysBucket} {
+				if _, er := tx.CreateBucketIfNotExists([]byte(name)); er != nil {
+					return er
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// SchemaVersion is the schema version of the data files written by this version
+var SchemaVersion = migrations[len(migrations)-1].Version
+
+// Migrate applies to db (opened from path) the migrations it misses. Unless the file is new, it is first copied to
+// a backup file next to it. On a dry run nothing is changed, the result only tells the pending migrations.
+func Migrate(db *bolt.DB, path string, dryRun bool) (MigrationResult, error) {
+	res := MigrationResult{}
+	var empty bool
+	er := db.View(func(tx *bolt.Tx) error {
+		var er error
+		res.From, er = readSchemaVersion(tx)
+		empty = isEmpty(tx)
+		return er
+	})
+	if er != nil {
+		return res, er
+	}
+	if res.From > SchemaVersion {
+		return res, fmt.Errorf("%w: the data file has schema version %d, this version only knows up to %d",
+			ErrSchemaTooNew, res.From, SchemaVersion)
+	}
+
+	res.To = res.From
+	for _, m := range migrations {
+		if m.Version > res.From {
+			res.Pending = append(res.Pending, m)
+		}
+	}
+	if dryRun || len(res.Pending) == 0 {
+		return res, nil
+	}
+
+	if !empty {
+		res.Backup = fmt.Sprintf("%s.v%d-%s.bak", path, res.From, time.Now().Format("20060102150405"))
+		er = db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(res.Backup, 0600)
+		})
+		if er != nil {
+			return res, fmt.Errorf("failed to backup the data file before migrating: %w", er)
+		}
+	}
+
+	for _, m := range res.Pending {
+		er = db.Update(func(tx *bolt.Tx) error {
+			if er := m.Apply(tx); er != nil {
+				return er
+			}
+			return writeSchemaVersion(tx, m.Version)
+		})
+		if er != nil {
+			return res, fmt.Errorf("migration to schema version %d (%s) failed: %w", m.Version, m.Description, er)
+		}
+		res.To = m.Version
+	}
+	return res, nil
+}
+
+// readSchemaVersion returns the schema version recorded in the meta bucket, 0 if there is none
+func readSchemaVersion(tx *bolt.Tx) (int, error) {
+	b := tx.Bucket([]byte(metaBucket))
+	if b == nil {
+		return 0, nil
+	}
+	v := b.Get([]byte(schemaVersionKey))
+	if v == nil {
+		return 0, nil
+	}
+	version, er := strconv.Atoi(string(v))
+	if er != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", v, er)
+	}
+	return version, nil
+}
+
+func writeSchemaVersion(tx *bolt.Tx, version int) error {
+	b, er := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if er != nil {
+		return er
+	}
+	return b.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(version)))
+}
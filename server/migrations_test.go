@@ -0,0 +1,68 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ = Describe("Migrate", func() {
+	ds := withTempDataStore()
+
+	schemaVersion := func() int {
+		var version int
+		Expect(ds.db.View(func(tx *bolt.Tx) error {
+			var er error
+			version, er = readSchemaVersion(tx)
+			return er
+		})).To(Succeed())
+		return version
+	}
+
+	It("Should migrate a new file without backup", func() {
+		res, er := Migrate(ds.db, ds.path, false)
+		Expect(er).To(BeNil())
+		Expect(res.From).To(Equal(0))
+		Expect(res.To).To(Equal(SchemaVersion))
+		Expect(res.Backup).To(BeEmpty())
+		Expect(schemaVersion()).To(Equal(SchemaVersion))
+
+		res, er = Migrate(ds.db, ds.path, false)
+		Expect(er).To(BeNil())
+		Expect(res.Pending).To(BeEmpty())
+	})
+
+	It("Should backup an existing file before migrating it", func() {
+		Expect(NewAddressStore(ds.db).Put("addr", []byte("record"))).To(Succeed())
+
+		res, er := Migrate(ds.db, ds.path, false)
+		Expect(er).To(BeNil())
+		Expect(res.Backup).NotTo(BeEmpty())
+
+		backup, er := bolt.Open(res.Backup, 0600, nil)
+		Expect(er).To(BeNil())
+		defer backup.Close()
+		Expect(backup.View(func(tx *bolt.Tx) error {
+			Expect(tx.Bucket([]byte(addressesBucket)).Get([]byte("addr"))).To(Equal([]byte("record")))
+			Expect(tx.Bucket([]byte(metaBucket))).To(BeNil())
+			return nil
+		})).To(Succeed())
+	})
+
+	It("Should not change anything on a dry run", func() {
+		res, er := Migrate(ds.db, ds.path, true)
+		Expect(er).To(BeNil())
+		Expect(res.Pending).To(HaveLen(len(migrations)))
+		Expect(res.To).To(Equal(0))
+		Expect(schemaVersion()).To(Equal(0))
+	})
+
+	It("Should refuse a file of a newer schema", func() {
+		Expect(ds.db.Update(func(tx *bolt.Tx) error {
+			return writeSchemaVersion(tx, SchemaVersion+1)
+		})).To(Succeed())
+
+		_, er := Migrate(ds.db, ds.path, false)
+		Expect(er).To(MatchError(ErrSchemaTooNew))
+	})
+})
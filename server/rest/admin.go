@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kataras/iris/v12"
+
+	"github.com/msaldanha/pulpit/service"
+)
+
+// configureAdminHandlers registers the node administration routes. They are only allowed to the tokens of the
+// configured admin addresses.
+func (s *Server) configureAdminHandlers(topLevel iris.Party) {
+	admin := topLevel.Party("/admin", s.authenticate, s.requireAdmin)
+	admin.Get("/accounts", s.getAccounts)
+	admin.Get("/accounts/{addr:string}", s.getAccount)
+	admin.Delete("/accounts/{addr:string}", s.deleteAccount)
+	admin.Post("/accounts/{addr:string}/logout", s.forceLogout)
+	admin.Delete("/accounts/{addr:string}/subscriptions/publications", s.clearAccountSubscriptionPublications)
+	admin.Get("/backup", s.backup)
+}
+
+// backup streams a snapshot of the data store. The snapshot is written to a temporary file first, so the read
+// transaction does not depend on the client. Once the body started, an error can only cut it short, which the client
+// detects by the Content-Length.
+func (s *Server) backup(ctx iris.Context) {
+	c := context.Background()
+	path, er := s.ps.Backup(c)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+	defer os.Remove(path)
+
+	f, er := os.Open(path)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+	defer f.Close()
+	info, er := f.Stat()
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	// a large snapshot can take longer than the write timeout of the server to download
+	_ = http.NewResponseController(ctx.ResponseWriter().Naive()).SetWriteDeadline(time.Time{})
+
+	name := fmt.Sprintf("pulpit-%s.dat", time.Now().Format("20060102150405"))
+	ctx.ContentType("application/octet-stream")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	ctx.Header("Content-Length", strconv.FormatInt(info.Size(), 10))
+	_, _ = io.Copy(ctx.ResponseWriter(), f)
+}
+
+// requireAdmin must follow authenticate: it only lets through the tokens of the admin addresses
+func (s *Server) requireAdmin(ctx iris.Context) {
+	claims, ok := tokenClaims(ctx)
+	if !ok {
+		returnError(ctx, ErrInvalidToken, 401)
+		return
+	}
+	if addr, _ := claims[addressClaim].(string); !s.admins[addr] {
+		returnError(ctx, ErrNotAdmin, 403)
+		return
+	}
+	ctx.Next()
+}
+
+func (s *Server) getAccounts(ctx iris.Context) {
+	c := context.Background()
+	stats, er := s.ps.AccountsStats(c)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+	_ = ctx.JSON(Response{Payload: stats})
+}
+
+func (s *Server) getAccount(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+	c := context.Background()
+	stats, er := s.ps.AccountStats(c, addr)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+	_ = ctx.JSON(Response{Payload: stats})
+}
+
+// deleteAccount ends the sessions of the address, revokes its tokens and deletes it
+func (s *Server) deleteAccount(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+	if er := s.endAccountSessions(addr); er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	c := context.Background()
+	er := s.ps.DeleteAddress(c, addr)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{})
+}
+
+// forceLogout ends all the sessions of the address and revokes its tokens
+func (s *Server) forceLogout(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+	if er := s.endAccountSessions(addr); er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+	_ = ctx.JSON(Response{})
+}
+
+// clearAccountSubscriptionPublications clears the composite timeline of the address, which only exists while it is
+// logged in
+func (s *Server) clearAccountSubscriptionPublications(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+	c := context.Background()
+	er := s.ps.ClearSubscriptionsPublications(c, addr)
+	if errors.Is(er, service.ErrNotLoggedIn) {
+		returnError(ctx, er, 409)
+		return
+	}
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+	_ = ctx.JSON(Response{})
+}
+
+func (s *Server) endAccountSessions(addr string) error {
+	c := context.Background()
+	if _, er := s.ps.AccountStats(c, addr); er != nil {
+		return er
+	}
+	er := s.ps.ForceLogout(c, addr)
+	if er != nil && !errors.Is(er, service.ErrNotLoggedIn) {
+		return er
+	}
+	return s.revocations.RevokeIssuedBefore(addr, time.Now())
+}
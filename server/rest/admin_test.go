@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kataras/iris/v12"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin", func() {
+	ts := withTestServer()
+
+	It("Should refuse every admin route to the tokens of the addresses not admin", func() {
+		tokens, er := ts.srv.issueTokens("user", "sid", false)
+		Expect(er).To(BeNil())
+
+		refused := 0
+		for _, r := range ts.app.GetRoutes() {
+			if !strings.HasPrefix(r.Path, basePath+"/admin") {
+				continue
+			}
+			path := strings.ReplaceAll(r.Path, ":addr", "user")
+			rec := do(ts.app, r.Method, path, tokens.Token, "")
+			Expect(rec.Code).To(Equal(403), r.Path)
+			Expect(rec.Body.String()).To(ContainSubstring(ErrNotAdmin.Error()), r.Path)
+			Expect(do(ts.app, r.Method, path, "", "").Code).To(Equal(401), r.Path)
+			refused++
+		}
+		Expect(refused).To(Equal(6))
+	})
+
+	It("Should let the tokens of the admin addresses through", func() {
+		app := iris.New()
+		app.Get("/admin", ts.srv.authenticate, ts.srv.requireAdmin, func(ctx iris.Context) {
+			_ = ctx.JSON(Response{})
+		})
+		Expect(app.Build()).To(Succeed())
+
+		admin, er := ts.srv.issueTokens("admin", "sid", false)
+		Expect(er).To(BeNil())
+		Expect(do(app, http.MethodGet, "/admin", admin.Token, "").Code).To(Equal(200))
+
+		user, er := ts.srv.issueTokens("user", "sid", false)
+		Expect(er).To(BeNil())
+		Expect(do(app, http.MethodGet, "/admin", user.Token, "").Code).To(Equal(403))
+	})
+})
@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"context"
+
+	"github.com/kataras/iris/v12"
+
+	"github.com/msaldanha/pulpit/models"
+	"github.com/msaldanha/pulpit/service"
+)
+
+const (
+	apiKeyHeader     = "X-Api-Key"
+	apiKeyContextKey = "apiKey"
+)
+
+// authenticateScope is authenticate for the routes also open to the api keys (given in the X-Api-Key header)
+// having scope. An api key without scope gets 403. The read scope routes also accept the read only tokens.
+func (s *Server) authenticateScope(scope string) iris.Handler {
+	authenticate := s.authenticate
+	if scope == service.ScopeRead {
+		authenticate = s.authenticateRead
+	}
+	return func(ctx iris.Context) {
+		key := ctx.GetHeader(apiKeyHeader)
+		if key == "" {
+			authenticate(ctx)
+			return
+		}
+		c := context.Background()
+		k, er := s.ps.CheckApiKey(c, key)
+		if er != nil {
+			returnError(ctx, er, getStatusCodeForError(er))
+			return
+		}
+		if !k.HasScope(scope) {
+			returnError(ctx, ErrInsufficientScope, 403)
+			return
+		}
+		ctx.Values().Set(apiKeyContextKey, k)
+		ctx.Next()
+	}
+}
+
+// apiKey returns the api key validated by authenticateScope
+func apiKey(ctx iris.Context) (models.ApiKey, bool) {
+	k, ok := ctx.Values().Get(apiKeyContextKey).(models.ApiKey)
+	return k, ok
+}
+
+// requestAddress returns the address of the token or of the api key of the request
+func requestAddress(ctx iris.Context) (string, bool) {
+	if k, ok := apiKey(ctx); ok {
+		return k.Address, true
+	}
+	claims, ok := tokenClaims(ctx)
+	if !ok {
+		return "", false
+	}
+	addr, _ := claims[addressClaim].(string)
+	return addr, addr != ""
+}
+
+func (s *Server) getApiKeys(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+	c := context.Background()
+	keys, er := s.ps.ListApiKeys(c, addr)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+	_ = ctx.JSON(Response{Payload: keys})
+}
+
+func (s *Server) createApiKey(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+
+	body := models.CreateApiKeyRequest{}
+	er := ctx.ReadJSON(&body)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	c := context.Background()
+	k, key, er := s.ps.CreateApiKey(c, addr, body.Name, body.Scopes)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{Payload: models.CreateApiKeyResponse{ApiKey: k, Key: key}})
+}
+
+func (s *Server) revokeApiKey(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+	id := ctx.Params().Get("id")
+	c := context.Background()
+	er := s.ps.RevokeApiKey(c, addr, id)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+	_ = ctx.JSON(Response{})
+}
@@ -5,6 +5,12 @@ import "errors"
 var (
 	ErrNotInitialized                   = errors.New("not initialized")
 	ErrAuthentication                   = errors.New("authentication failed")
+	ErrInvalidToken                     = errors.New("invalid token")
+	ErrForbidden                        = errors.New("the token does not grant access to this address")
+	ErrInsufficientScope                = errors.New("the api key does not have the scope needed")
+	ErrNotAdmin                         = errors.New("the token is not of a node administrator")
+	ErrReadOnlySession                  = errors.New("the session was opened with a signature and is read only")
+	ErrTooManyRequests                  = errors.New("too many requests")
 	ErrExpectedBoltKeyValueStoreOptions = errors.New("expected BoltKeyValueStoreOptions type")
 	ErrInvalidBucketName                = errors.New("invalid bucket name")
 )
@@ -2,44 +2,87 @@ package rest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
 
-	"github.com/iris-contrib/middleware/jwt"
 	"github.com/kataras/iris/v12"
 
+	"github.com/msaldanha/setinstone/address"
+
+	"github.com/msaldanha/pulpit/metrics"
 	"github.com/msaldanha/pulpit/models"
+	"github.com/msaldanha/pulpit/service"
 )
 
-func (s *Server) configuredHandlers(app *iris.Application, j *jwt.Middleware) {
+// configuredHandlers registers the api routes. The routes having the {addr} parameter and changing or exposing
+// private data of the address are guarded by authenticate (401 without a valid token) and authorize (403 if the
+// token is of another address). The routes an api key can use are guarded by authenticateScope instead of
+// authenticate. The subscriptions feed is only kept while the address is logged in, so it needs a token. A session
+// opened with a signature is read only: only the routes guarded by authenticateRead (or authenticateScope with the
+// read scope) accept its tokens, every other one answers 403. The routes checking a password are rate limited (429) as the login, and so are address creation, posting and media upload.
+func (s *Server) configuredHandlers(app *iris.Application) {
 	topLevel := app.Party(basePath)
+	topLevel.Use(s.instrument)
 
-	topLevel.Get("/media", j.Serve, s.getMedia)
-	topLevel.Post("/media", j.Serve, s.postMedia)
-	topLevel.Post("/login", s.login)
+	topLevel.Get("/media", s.authenticateScope(service.ScopeRead), s.getMedia)
+	topLevel.Post("/media", s.authenticateScope(service.ScopePost), s.limit(s.mediaLimiter), s.postMedia)
+	topLevel.Post("/login", s.limit(s.loginLimiter), s.login)
+	topLevel.Post("/challenge", s.limit(s.loginLimiter), s.challenge)
+	topLevel.Post("/refresh", s.refresh)
+	topLevel.Post("/logout", s.authenticateRead, s.logout)
 
 	addresses := topLevel.Party("/addresses")
-	addresses.Get("randomaddress", j.Serve, s.getRandomAddress)
-	addresses.Get("/", j.Serve, s.getAddresses)
-	addresses.Post("/", j.Serve, s.createAddress)
-	addresses.Delete("/{addr:string}", s.deleteAddress, j.Serve)
+	addresses.Get("randomaddress", s.authenticate, s.getRandomAddress)
+	addresses.Get("/", s.authenticate, s.getAddresses)
+	addresses.Post("/", s.authenticate, s.limit(s.addressLimiter), s.createAddress)
+	addresses.Post("/import", s.authenticate, s.limit(s.addressLimiter), s.importAddress)
+	addresses.Post("/recover", s.authenticate, s.limit(s.addressLimiter), s.recoverAddress)
+	addresses.Post("/{addr:string}/export", s.authenticate, s.authorize, s.limit(s.loginLimiter), s.exportAddress)
+	addresses.Delete("/{addr:string}", s.authenticate, s.authorize, s.deleteAddress)
+
+	topLevel.Post("/{addr:string}/unlock", s.authenticate, s.authorize, s.limit(s.loginLimiter), s.unlock)
+	topLevel.Post("/{addr:string}/password", s.authenticate, s.authorize, s.limit(s.loginLimiter), s.changePassword)
+
+	topLevel.Get("/{addr:string}/apikeys", s.authenticate, s.authorize, s.getApiKeys)
+	topLevel.Post("/{addr:string}/apikeys", s.authenticate, s.authorize, s.createApiKey)
+	topLevel.Delete("/{addr:string}/apikeys/{id:string}", s.authenticate, s.authorize, s.revokeApiKey)
+
+	post := s.authenticateScope(service.ScopePost)
+	read := s.authenticateScope(service.ScopeRead)
+	subscriptions := s.authenticateScope(service.ScopeSubscriptions)
 
 	topLevel.Get("/{addr:string}/publications", s.getItems)
 	topLevel.Get("/{addr:string}/publications/{key:string}", s.getItemByKey)
 	topLevel.Get("/{addr:string}/publications/{key:string}/{connector:string}", s.getItems)
-	topLevel.Post("/{addr:string}/publications", j.Serve, s.createItem)
-	topLevel.Post("/{addr:string}/publications/{key:string}/{connector:string}", j.Serve, s.createItem)
-
-	topLevel.Get("/{addr:string}/subscriptions", j.Serve, s.getSubscriptions)
-	topLevel.Post("/{addr:string}/subscriptions", j.Serve, s.addSubscription)
-	topLevel.Delete("/{addr:string}/subscriptions", j.Serve, s.removeSubscription)
-	topLevel.Get("/{addr:string}/subscriptions/publications", s.getSubscriptionsPublications)
-	topLevel.Delete("/{addr:string}/subscriptions/publications", j.Serve, s.clearSubscriptionPublications)
+	topLevel.Post("/{addr:string}/publications", post, s.authorize, s.limit(s.postLimiter), s.createItem)
+	topLevel.Post("/{addr:string}/publications/{key:string}/{connector:string}", post, s.authorize, s.limit(s.postLimiter),
+		s.createItem)
+
+	topLevel.Get("/{addr:string}/subscriptions", read, s.authorize, s.getSubscriptions)
+	topLevel.Post("/{addr:string}/subscriptions", subscriptions, s.authorize, s.addSubscription)
+	topLevel.Delete("/{addr:string}/subscriptions", subscriptions, s.authorize, s.removeSubscription)
+	topLevel.Get("/{addr:string}/subscriptions/publications", s.authenticateRead, s.authorize,
+		s.getSubscriptionsPublications)
+	topLevel.Delete("/{addr:string}/subscriptions/publications", s.authenticate, s.authorize,
+		s.clearSubscriptionPublications)
+
+	s.configureAdminHandlers(topLevel)
+}
+
+func (s *Server) instrument(ctx iris.Context) {
+	start := time.Now()
+	ctx.Next()
+	route := "unknown"
+	if r := ctx.GetCurrentRoute(); r != nil {
+		route = r.Path()
+	}
+	metrics.ObserveRequest(route, ctx.Method(), ctx.GetStatusCode(), time.Since(start))
 }
 
 func (s *Server) createAddress(ctx iris.Context) {
-	body := models.LoginRequest{}
+	body := models.CreateAddressRequest{}
 	er := ctx.ReadJSON(&body)
 	if er != nil {
 		returnError(ctx, er, getStatusCodeForError(er))
@@ -53,6 +96,16 @@ func (s *Server) createAddress(ctx iris.Context) {
 	}
 
 	c := context.Background()
+	if body.Mnemonic {
+		addr, mnemonic, er := s.ps.CreateAddressWithMnemonic(c, pass)
+		if er != nil {
+			returnError(ctx, er, getStatusCodeForError(er))
+			return
+		}
+		_ = ctx.JSON(Response{Payload: models.CreateAddressResponse{Address: addr, Mnemonic: mnemonic}})
+		return
+	}
+
 	key, er := s.ps.CreateAddress(c, pass)
 
 	if er != nil {
@@ -63,14 +116,105 @@ func (s *Server) createAddress(ctx iris.Context) {
 	_ = ctx.JSON(Response{Payload: key})
 }
 
+func (s *Server) recoverAddress(ctx iris.Context) {
+	body := models.RecoverAddressRequest{}
+	er := ctx.ReadJSON(&body)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	if body.Mnemonic == "" || body.Password == "" {
+		returnError(ctx, fmt.Errorf("mnemonic and password cannot be empty"), 400)
+		return
+	}
+
+	c := context.Background()
+	addr, er := s.ps.RecoverAddress(c, body.Mnemonic, body.Password)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	// the sessions were ended, so the tokens issued for them are revoked
+	er = s.revocations.RevokeIssuedBefore(addr, time.Now())
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{Payload: addr})
+}
+
+func (s *Server) exportAddress(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+
+	body := models.ExportAddressRequest{}
+	er := ctx.ReadJSON(&body)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	c := context.Background()
+	ks, er := s.ps.ExportAddress(c, addr, body.Password, body.KeystorePassword)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{Payload: ks})
+}
+
+func (s *Server) importAddress(ctx iris.Context) {
+	body := models.ImportAddressRequest{}
+	er := ctx.ReadJSON(&body)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	if (body.Keystore == nil) == (body.PrivateKey == "") {
+		returnError(ctx, fmt.Errorf("either keystore or privateKey must be given"), 400)
+		return
+	}
+
+	if body.PrivateKey != "" && body.Password == "" {
+		returnError(ctx, fmt.Errorf("password cannot be empty"), 400)
+		return
+	}
+
+	c := context.Background()
+	var addr string
+	if body.Keystore != nil {
+		addr, er = s.ps.ImportAddress(c, body.Keystore, body.KeystorePassword, body.Password)
+	} else {
+		addr, er = s.ps.ImportPrivateKey(c, body.PrivateKey, body.Password)
+	}
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{Payload: addr})
+}
+
+// deleteAddress ends the sessions of the address, revokes its tokens and deletes it, as the admin deleteAccount
 func (s *Server) deleteAddress(ctx iris.Context) {
 	addr := ctx.Params().Get("addr")
+	if er := s.endAccountSessions(addr); er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
 	c := context.Background()
 	er := s.ps.DeleteAddress(c, addr)
 	if er != nil {
 		returnError(ctx, er, getStatusCodeForError(er))
 		return
 	}
+
+	_ = ctx.JSON(Response{})
 }
 
 func (s *Server) login(ctx iris.Context) {
@@ -86,26 +230,190 @@ func (s *Server) login(ctx iris.Context) {
 		return
 	}
 
-	if body.Password == "" {
-		returnError(ctx, fmt.Errorf("password cannot be empty"), 400)
+	if body.Password == "" && body.Signature == "" {
+		returnError(ctx, fmt.Errorf("password or signature must be given"), 400)
+		return
+	}
+
+	// there is no token yet, so the address is limited here
+	if !s.allow(ctx, s.loginLimiter, "addr:"+body.Address) {
 		return
 	}
 
 	c := context.Background()
-	er = s.ps.Login(c, body.Address, body.Password)
+	if body.Signature != "" {
+		er = s.ps.LoginWithSignature(c, body.Address, body.PublicKey, body.Nonce, body.Signature)
+	} else {
+		er = s.ps.Login(c, body.Address, body.Password)
+	}
 	if er != nil {
 		returnError(ctx, er, getStatusCodeForError(er))
 		return
 	}
 
-	token := jwt.NewTokenWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		addressClaim: body.Address,
-	})
+	sid, er := newTokenId()
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	// the key of a signature login stays with the client, so its session is read only
+	tokens, er := s.issueTokens(body.Address, sid, body.Signature != "")
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{Payload: tokens})
+}
+
+// challenge issues the challenge to be signed by the key of an address to login without its password
+func (s *Server) challenge(ctx iris.Context) {
+	body := models.ChallengeRequest{}
+	er := ctx.ReadJSON(&body)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	if body.Address == "" {
+		returnError(ctx, fmt.Errorf("address cannot be empty"), 400)
+		return
+	}
+
+	if !s.allow(ctx, s.loginLimiter, "addr:"+body.Address) {
+		return
+	}
 
-	// Sign and get the complete encoded token as a string using the secret
-	tokenString, _ := token.SignedString([]byte(s.secret))
+	c := context.Background()
+	ch, er := s.ps.NewChallenge(c, body.Address)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
 
-	_ = ctx.JSON(Response{Payload: tokenString})
+	_ = ctx.JSON(Response{Payload: ch})
+}
+
+func (s *Server) refresh(ctx iris.Context) {
+	body := models.RefreshRequest{}
+	er := ctx.ReadJSON(&body)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	if body.RefreshToken == "" {
+		returnError(ctx, fmt.Errorf("refreshToken cannot be empty"), 400)
+		return
+	}
+
+	claims, er := s.parseToken(body.RefreshToken, refreshToken)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	// the session may be gone (i.e. the server was restarted), a new login is needed then
+	addr := claims[addressClaim].(string)
+	if !s.ps.IsLoggedIn(addr) {
+		returnError(ctx, fmt.Errorf("%w: not logged in", ErrInvalidToken), 401)
+		return
+	}
+
+	// a refresh token can only be used once: of concurrent refreshes with it, only the one revoking it goes on
+	er = s.revokeToken(claims)
+	if errors.Is(er, service.ErrAlreadyRevoked) {
+		er = fmt.Errorf("%w: token was revoked", ErrInvalidToken)
+	}
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	tokens, er := s.issueTokens(addr, claims[sidClaim].(string), isReadOnly(claims))
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{Payload: tokens})
+}
+
+func (s *Server) logout(ctx iris.Context) {
+	claims, ok := tokenClaims(ctx)
+	if !ok {
+		returnError(ctx, ErrInvalidToken, 401)
+		return
+	}
+
+	er := s.revokeSession(claims)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	c := context.Background()
+	er = s.ps.Logout(c, claims[addressClaim].(string))
+	// the session may be gone already (i.e. the server was restarted), revoking its tokens is enough then
+	if er != nil && !errors.Is(er, service.ErrNotLoggedIn) {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{})
+}
+
+func (s *Server) unlock(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+
+	body := models.LoginRequest{}
+	er := ctx.ReadJSON(&body)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	c := context.Background()
+	er = s.ps.Unlock(c, addr, body.Password)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{})
+}
+
+func (s *Server) changePassword(ctx iris.Context) {
+	addr := ctx.Params().Get("addr")
+
+	body := models.ChangePasswordRequest{}
+	er := ctx.ReadJSON(&body)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	if body.NewPassword == "" {
+		returnError(ctx, fmt.Errorf("newPassword cannot be empty"), 400)
+		return
+	}
+
+	c := context.Background()
+	er = s.ps.ChangePassword(c, addr, body.OldPassword, body.NewPassword)
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	// the sessions were ended, so the tokens issued for them are revoked
+	er = s.revocations.RevokeIssuedBefore(addr, time.Now())
+	if er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+
+	_ = ctx.JSON(Response{})
 }
 
 func (s *Server) getRandomAddress(ctx iris.Context) {
@@ -120,7 +428,7 @@ func (s *Server) getRandomAddress(ctx iris.Context) {
 
 func (s *Server) getMedia(ctx iris.Context) {
 	id := ctx.URLParam("id")
-	c, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	c, cancel := context.WithTimeout(context.Background(), s.mediaTimeout)
 	defer cancel()
 	f, er := s.ps.GetMedia(c, id)
 	if er != nil {
@@ -148,13 +456,26 @@ func (s *Server) postMedia(ctx iris.Context) {
 	_ = ctx.JSON(Response{Payload: results})
 }
 
+// getAddresses lists the local addresses the token grants access to, i.e. only its own
 func (s *Server) getAddresses(ctx iris.Context) {
+	claims, ok := tokenClaims(ctx)
+	if !ok {
+		returnError(ctx, ErrInvalidToken, 401)
+		return
+	}
+
 	c := context.Background()
-	addresses, er := s.ps.GetAddresses(c)
+	all, er := s.ps.GetAddresses(c)
 	if er != nil {
 		returnError(ctx, er, getStatusCodeForError(er))
 		return
 	}
+	addresses := []*address.Address{}
+	for _, a := range all {
+		if a.Address == claims[addressClaim] {
+			addresses = append(addresses, a)
+		}
+	}
 	_ = ctx.JSON(Response{Payload: addresses})
 }
 
@@ -211,22 +532,6 @@ func (s *Server) createItem(ctx iris.Context) {
 		connector = "main"
 	}
 
-	tkValue := ctx.Values().Get("jwt")
-	if tkValue == nil {
-		ctx.StatusCode(401)
-		return
-	}
-	user, ok := tkValue.(*jwt.Token)
-	if !ok {
-		ctx.StatusCode(401)
-		return
-	}
-	claims := user.Claims.(jwt.MapClaims)
-	if claims[addressClaim] != addr {
-		ctx.StatusCode(401)
-		return
-	}
-
 	body := models.AddItemRequest{}
 	er := ctx.ReadJSON(&body)
 	if er != nil {
@@ -235,7 +540,12 @@ func (s *Server) createItem(ctx iris.Context) {
 	}
 
 	c := context.Background()
-	key, er := s.ps.CreateItem(c, addr, keyRoot, connector, body)
+	var key string
+	if _, ok := apiKey(ctx); ok {
+		key, er = s.ps.CreateItemWithApiKey(c, ctx.GetHeader(apiKeyHeader), addr, keyRoot, connector, body)
+	} else {
+		key, er = s.ps.CreateItem(c, addr, keyRoot, connector, body)
+	}
 	if er != nil {
 		returnError(ctx, er, getStatusCodeForError(er))
 		return
@@ -309,14 +619,6 @@ func (s *Server) clearSubscriptionPublications(ctx iris.Context) {
 func (s *Server) addSubscription(ctx iris.Context) {
 	addr := ctx.Params().Get("addr")
 
-	user := ctx.Values().Get("jwt").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-
-	if claims[addressClaim] != addr {
-		ctx.StatusCode(401)
-		return
-	}
-
 	body := models.AddSubscriptionRequest{}
 	er := ctx.ReadJSON(&body)
 	if er != nil {
@@ -340,14 +642,6 @@ func (s *Server) addSubscription(ctx iris.Context) {
 func (s *Server) removeSubscription(ctx iris.Context) {
 	addr := ctx.Params().Get("addr")
 
-	user := ctx.Values().Get("jwt").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-
-	if claims[addressClaim] != addr {
-		ctx.StatusCode(401)
-		return
-	}
-
 	body := models.AddSubscriptionRequest{}
 	er := ctx.ReadJSON(&body)
 	if er != nil {
@@ -0,0 +1,148 @@
+package rest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"golang.org/x/time/rate"
+)
+
+// RateLimit allows Count requests per Period, in bursts of up to Count requests. The zero value disables it.
+type RateLimit struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseRateLimit parses a rate limit of the form <count>/<period>, i.e. 10/1m. An empty string or a zero count
+// disables it.
+func ParseRateLimit(s string) (RateLimit, error) {
+	if s == "" {
+		return RateLimit{}, nil
+	}
+	count, period, found := strings.Cut(s, "/")
+	if !found {
+		return RateLimit{}, fmt.Errorf("rate limit must have the form <count>/<period>, got %q", s)
+	}
+	n, er := strconv.Atoi(count)
+	if er != nil || n < 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit count %q", count)
+	}
+	d, er := time.ParseDuration(period)
+	if er != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit period %q", period)
+	}
+	if n == 0 {
+		return RateLimit{}, nil
+	}
+	return RateLimit{Count: n, Period: d}, nil
+}
+
+// rateLimiter keeps a token bucket per key (client IP or address)
+type rateLimiter struct {
+	mtx       sync.Mutex
+	limit     RateLimit
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter returns nil if limit is disabled. A nil rateLimiter allows everything.
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Count == 0 {
+		return nil
+	}
+	return &rateLimiter{
+		limit:     limit,
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from the bucket of key. If there is none, it returns false and the time until the next one.
+func (r *rateLimiter) allow(key string) (bool, time.Duration) {
+	if r == nil {
+		return true, 0
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	now := time.Now()
+	r.sweep(now)
+	b, found := r.buckets[key]
+	if !found {
+		b = &bucket{limiter: rate.NewLimiter(rate.Every(r.limit.Period/time.Duration(r.limit.Count)), r.limit.Count)}
+		r.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	res := b.limiter.ReserveN(now, 1)
+	if delay := res.DelayFrom(now); delay > 0 {
+		res.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// sweep forgets the buckets not used for a whole period, as they are full again anyway
+func (r *rateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.limit.Period {
+		return
+	}
+	for key, b := range r.buckets {
+		if now.Sub(b.lastSeen) >= r.limit.Period {
+			delete(r.buckets, key)
+		}
+	}
+	r.lastSweep = now
+}
+
+// limit returns a middleware limiting the requests of each client IP and, when there is a token or an api key, of
+// its address
+func (s *Server) limit(l *rateLimiter) iris.Handler {
+	return func(ctx iris.Context) {
+		if !s.allow(ctx, l, "ip:"+ctx.RemoteAddr()) {
+			return
+		}
+		if addr, ok := requestAddress(ctx); ok && !s.allow(ctx, l, "addr:"+addr) {
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// LimitIP returns a middleware limiting the requests of each client IP to limit, for the routes served outside the
+// api (i.e. the web login)
+func LimitIP(limit RateLimit) iris.Handler {
+	l := newRateLimiter(limit)
+	return func(ctx iris.Context) {
+		if ok, delay := l.allow("ip:" + ctx.RemoteAddr()); !ok {
+			tooManyRequests(ctx, delay)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// allow takes a token of key from l. If there is none, it answers 429 telling when to retry and returns false.
+func (s *Server) allow(ctx iris.Context, l *rateLimiter, key string) bool {
+	ok, delay := l.allow(key)
+	if ok {
+		return true
+	}
+	tooManyRequests(ctx, delay)
+	return false
+}
+
+func tooManyRequests(ctx iris.Context, retryAfter time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	returnError(ctx, ErrTooManyRequests, 429)
+}
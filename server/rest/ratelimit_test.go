@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimit", func() {
+	It("Should parse <count>/<period>", func() {
+		l, er := ParseRateLimit("10/1m")
+		Expect(er).To(BeNil())
+		Expect(l).To(Equal(RateLimit{Count: 10, Period: time.Minute}))
+
+		for _, disabled := range []string{"", "0/1m"} {
+			l, er = ParseRateLimit(disabled)
+			Expect(er).To(BeNil())
+			Expect(l).To(Equal(RateLimit{}))
+		}
+
+		for _, invalid := range []string{"10", "x/1m", "-1/1m", "10/x", "10/0s"} {
+			_, er = ParseRateLimit(invalid)
+			Expect(er).NotTo(BeNil(), invalid)
+		}
+	})
+
+	It("Should allow bursts of count requests per key and refill them over the period", func() {
+		l := newRateLimiter(RateLimit{Count: 2, Period: 200 * time.Millisecond})
+		for i := 0; i < 2; i++ {
+			ok, _ := l.allow("a")
+			Expect(ok).To(BeTrue())
+		}
+		ok, delay := l.allow("a")
+		Expect(ok).To(BeFalse())
+		Expect(delay).To(BeNumerically(">", 0))
+		Expect(delay).To(BeNumerically("<=", 100*time.Millisecond))
+
+		ok, _ = l.allow("b")
+		Expect(ok).To(BeTrue())
+
+		time.Sleep(delay)
+		ok, _ = l.allow("a")
+		Expect(ok).To(BeTrue())
+		ok, _ = l.allow("a")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should allow everything when disabled", func() {
+		l := newRateLimiter(RateLimit{})
+		Expect(l).To(BeNil())
+		for i := 0; i < 100; i++ {
+			ok, _ := l.allow("a")
+			Expect(ok).To(BeTrue())
+		}
+	})
+
+	It("Should answer 429 with Retry-After once the client IP has no tokens", func() {
+		s := &Server{}
+		app := iris.New()
+		app.Get("/", s.limit(newRateLimiter(RateLimit{Count: 1, Period: time.Minute})), func(ctx iris.Context) {
+			_ = ctx.JSON(Response{})
+		})
+		Expect(app.Build()).To(Succeed())
+
+		get := func(remoteAddr string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = remoteAddr
+			app.ServeHTTP(rec, req)
+			return rec
+		}
+
+		Expect(get("192.0.2.1:1000").Code).To(Equal(200))
+		rec := get("192.0.2.1:1001")
+		Expect(rec.Code).To(Equal(429))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("60"))
+		Expect(rec.Body.String()).To(ContainSubstring(ErrTooManyRequests.Error()))
+		Expect(get("192.0.2.2:1000").Code).To(Equal(200))
+	})
+})
@@ -2,7 +2,7 @@ package rest
 
 import (
 	"errors"
-	"os"
+	"time"
 
 	"github.com/iris-contrib/middleware/jwt"
 	"github.com/kataras/iris/v12"
@@ -14,22 +14,43 @@ import (
 )
 
 const (
-	defaultCount = 20
-	addressClaim = "address"
-	basePath     = "/api/v1"
+	defaultCount  = 20
+	addressClaim  = "address"
+	basePath      = "/api/v1"
+	jwtContextKey = "jwt"
 )
 
 type Server struct {
-	ps     *service.PulpitService
-	secret string
+	ps              *service.PulpitService
+	secret          string
+	mediaTimeout    time.Duration
+	tokenTTL        time.Duration
+	refreshTokenTTL time.Duration
+	revocations     *service.Revocations
+	jwt             *jwt.Middleware
+	admins          map[string]bool
+	loginLimiter    *rateLimiter
+	addressLimiter  *rateLimiter
+	postLimiter     *rateLimiter
+	mediaLimiter    *rateLimiter
 }
 
 type Options struct {
-	Url           string
-	Store         service.KeyValueStore
-	DataStore     string
-	Logger        *zap.Logger
-	PulpitService *service.PulpitService
+	Url             string
+	Store           service.KeyValueStore
+	DataStore       string
+	Logger          *zap.Logger
+	PulpitService   *service.PulpitService
+	Secret          string
+	MediaTimeout    time.Duration
+	TokenTTL        time.Duration
+	RefreshTokenTTL time.Duration
+	Revocations     *service.Revocations
+	Admins          []string
+	LoginRate       RateLimit
+	AddressRate     RateLimit
+	PostRate        RateLimit
+	MediaRate       RateLimit
 }
 
 type Response struct {
@@ -37,18 +58,36 @@ type Response struct {
 	Error   string      `json:"error,omitempty"`
 }
 
-func ConfigureApiServer(app *iris.Application, service *service.PulpitService) {
+func ConfigureApiServer(app *iris.Application, opts Options) {
+	newServer(opts).configuredHandlers(app)
+}
+
+func newServer(opts Options) *Server {
 	srv := &Server{
-		secret: os.Getenv("SERVER_SECRET"),
-		ps:     service,
+		secret:          opts.Secret,
+		ps:              opts.PulpitService,
+		mediaTimeout:    opts.MediaTimeout,
+		tokenTTL:        opts.TokenTTL,
+		refreshTokenTTL: opts.RefreshTokenTTL,
+		revocations:     opts.Revocations,
+		admins:          map[string]bool{},
+		loginLimiter:    newRateLimiter(opts.LoginRate),
+		addressLimiter:  newRateLimiter(opts.AddressRate),
+		postLimiter:     newRateLimiter(opts.PostRate),
+		mediaLimiter:    newRateLimiter(opts.MediaRate),
+	}
+	for _, addr := range opts.Admins {
+		srv.admins[addr] = true
 	}
-	j := jwt.New(jwt.Config{
-		ValidationKeyGetter: func(token *jwt.Token) (interface{}, error) {
-			return []byte(srv.secret), nil
-		},
-		SigningMethod: jwt.SigningMethodHS256,
+	srv.jwt = jwt.New(jwt.Config{
+		ValidationKeyGetter: srv.validationKey,
+		SigningMethod:       jwt.SigningMethodHS256,
+		ContextKey:          jwtContextKey,
+		Expiration:          true,
+		// authenticate writes the errors itself, in the api format
+		ErrorHandler: func(iris.Context, error) {},
 	})
-	srv.configuredHandlers(app, j)
+	return srv
 }
 
 func returnError(ctx iris.Context, er error, statusCode int) {
@@ -69,11 +108,51 @@ func getStatusCodeForError(er error) int {
 	case errors.Is(er, timeline.ErrNotAReference):
 		fallthrough
 	case errors.Is(er, timeline.ErrCannotAddRefToNotOwnedItem):
+		fallthrough
+	case errors.Is(er, service.ErrInvalidKeystore):
+		fallthrough
+	case errors.Is(er, service.ErrInvalidPrivateKey):
+		fallthrough
+	case errors.Is(er, service.ErrInvalidMnemonic):
+		fallthrough
+	case errors.Is(er, service.ErrInvalidScope):
 		return 400
 	case errors.Is(er, ErrAuthentication):
+		fallthrough
+	case errors.Is(er, ErrInvalidToken):
+		fallthrough
+	case errors.Is(er, service.ErrNotLoggedIn):
+		fallthrough
+	case errors.Is(er, service.ErrInvalidPassword):
+		fallthrough
+	case errors.Is(er, service.ErrInvalidApiKey):
+		fallthrough
+	case errors.Is(er, service.ErrInvalidSignature):
+		fallthrough
+	case errors.Is(er, service.ErrAlreadyRevoked):
 		return 401
+	case errors.Is(er, ErrForbidden):
+		fallthrough
+	case errors.Is(er, ErrNotAdmin):
+		fallthrough
+	case errors.Is(er, ErrReadOnlySession):
+		fallthrough
+	case errors.Is(er, ErrInsufficientScope):
+		return 403
 	case errors.Is(er, timeline.ErrNotFound):
+		fallthrough
+	case errors.Is(er, service.ErrAddressNotFound):
+		fallthrough
+	case errors.Is(er, service.ErrApiKeyNotFound):
 		return 404
+	case errors.Is(er, service.ErrAddressExists):
+		return 409
+	case errors.Is(er, service.ErrLocked):
+		return 423
+	case errors.Is(er, ErrTooManyRequests):
+		fallthrough
+	case errors.Is(er, service.ErrTooManyAttempts):
+		return 429
 	default:
 		return 500
 	}
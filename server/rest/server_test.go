@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/msaldanha/pulpit/service"
+)
+
+// testServer is a Server without a PulpitService, with its revocations in a temporary bolt file, and the app
+// serving its routes. It is enough for the specs of the middlewares, which answer before the handlers.
+type testServer struct {
+	dir string
+	db  *bolt.DB
+	srv *Server
+	app *iris.Application
+}
+
+// withTestServer creates a new testServer before each spec of the container and removes its files after
+func withTestServer() *testServer {
+	t := &testServer{}
+	BeforeEach(func() {
+		var er error
+		t.dir, er = os.MkdirTemp("", "pulpit-rest")
+		Expect(er).To(BeNil())
+		t.db, er = bolt.Open(filepath.Join(t.dir, "test.dat"), 0600, &bolt.Options{Timeout: 1 * time.Second})
+		Expect(er).To(BeNil())
+		t.srv = newServer(Options{
+			Secret:          "secret",
+			TokenTTL:        time.Minute,
+			RefreshTokenTTL: time.Hour,
+			Revocations:     service.NewRevocations(service.NewBoltKeyValueStore(t.db, "revocations")),
+			Admins:          []string{"admin"},
+		})
+		t.app = iris.New()
+		t.srv.configuredHandlers(t.app)
+		Expect(t.app.Build()).To(Succeed())
+	})
+	AfterEach(func() {
+		_ = t.db.Close()
+		_ = os.RemoveAll(t.dir)
+	})
+	return t
+}
+
+// guardedApp returns an app serving the {addr} routes /read (authenticateRead), /scope (authenticateScope with the
+// read scope) and /write (authenticate), all guarded by authorize too, with the middlewares of srv
+func guardedApp(srv *Server) *iris.Application {
+	app := iris.New()
+	ok := func(ctx iris.Context) { _ = ctx.JSON(Response{}) }
+	app.Get("/read/{addr:string}", srv.authenticateRead, srv.authorize, ok)
+	app.Get("/scope/{addr:string}", srv.authenticateScope(service.ScopeRead), srv.authorize, ok)
+	app.Post("/write/{addr:string}", srv.authenticate, srv.authorize, ok)
+	Expect(app.Build()).To(Succeed())
+	return app
+}
+
+// do serves a request to handler with token as the bearer token, if any
+func do(handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,210 @@
+package rest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v4"
+	"github.com/iris-contrib/middleware/jwt"
+	"github.com/kataras/iris/v12"
+
+	"github.com/msaldanha/pulpit/models"
+)
+
+const (
+	typeClaim     = "typ"
+	jtiClaim      = "jti"
+	sidClaim      = "sid"
+	expClaim      = "exp"
+	iatClaim      = "iat"
+	readOnlyClaim = "ro"
+
+	accessToken  = "access"
+	refreshToken = "refresh"
+)
+
+// issueTokens returns a new access/refresh token pair for the session sid of addr, carrying the read only claim
+// if readOnly
+func (s *Server) issueTokens(addr, sid string, readOnly bool) (models.LoginResponse, error) {
+	now := time.Now()
+	access, er := s.signToken(addr, sid, accessToken, readOnly, now, s.tokenTTL)
+	if er != nil {
+		return models.LoginResponse{}, er
+	}
+	refresh, er := s.signToken(addr, sid, refreshToken, readOnly, now, s.refreshTokenTTL)
+	if er != nil {
+		return models.LoginResponse{}, er
+	}
+	return models.LoginResponse{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresAt:    now.Add(s.tokenTTL).Unix(),
+	}, nil
+}
+
+func (s *Server) signToken(addr, sid, typ string, readOnly bool, now time.Time, ttl time.Duration) (string, error) {
+	jti, er := newTokenId()
+	if er != nil {
+		return "", er
+	}
+	claims := jwt.MapClaims{
+		addressClaim: addr,
+		typeClaim:    typ,
+		jtiClaim:     jti,
+		sidClaim:     sid,
+		iatClaim:     issuedAt(now),
+		expClaim:     now.Add(ttl).Unix(),
+	}
+	if readOnly {
+		claims[readOnlyClaim] = true
+	}
+	token := jwt.NewTokenWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(s.secret))
+}
+
+// parseToken validates the signature, the expiration and the type of a token and returns its claims
+func (s *Server) parseToken(tokenString, typ string) (jwt.MapClaims, error) {
+	token, er := gojwt.Parse(tokenString, s.validationKey, gojwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if er != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, er)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if er = s.checkClaims(claims, typ); er != nil {
+		return nil, er
+	}
+	return claims, nil
+}
+
+// revokeSession revokes all the tokens issued for the session of claims
+func (s *Server) revokeSession(claims jwt.MapClaims) error {
+	sid, _ := claims[sidClaim].(string)
+	return s.revocations.Revoke(sid, time.Now().Add(s.refreshTokenTTL))
+}
+
+// revokeToken revokes the single token of claims
+func (s *Server) revokeToken(claims jwt.MapClaims) error {
+	jti, _ := claims[jtiClaim].(string)
+	exp, _ := claims[expClaim].(float64)
+	return s.revocations.Revoke(jti, time.Unix(int64(exp), 0))
+}
+
+func (s *Server) validationKey(_ *jwt.Token) (interface{}, error) {
+	return []byte(s.secret), nil
+}
+
+// authenticate is the jwt middleware for the protected routes: besides checking the signature it requires a
+// not expired access token (refresh tokens are only accepted by the refresh endpoint). The tokens of a session
+// opened with a signature are read only and get 403, see authenticateRead.
+func (s *Server) authenticate(ctx iris.Context) {
+	s.authenticateToken(ctx, false)
+}
+
+// authenticateRead is authenticate for the routes only reading the data of the address, which also accept the read
+// only tokens
+func (s *Server) authenticateRead(ctx iris.Context) {
+	s.authenticateToken(ctx, true)
+}
+
+func (s *Server) authenticateToken(ctx iris.Context, allowReadOnly bool) {
+	if er := s.jwt.CheckJWT(ctx); er != nil {
+		returnError(ctx, fmt.Errorf("%w: %s", ErrInvalidToken, er), 401)
+		return
+	}
+	claims, ok := tokenClaims(ctx)
+	if !ok {
+		returnError(ctx, ErrInvalidToken, 401)
+		return
+	}
+	if er := s.checkClaims(claims, accessToken); er != nil {
+		returnError(ctx, er, getStatusCodeForError(er))
+		return
+	}
+	if isReadOnly(claims) && !allowReadOnly {
+		returnError(ctx, ErrReadOnlySession, 403)
+		return
+	}
+	ctx.Next()
+}
+
+// authorize must follow authenticate: it only lets through the requests whose token (or api key) address is the
+// {addr} one
+func (s *Server) authorize(ctx iris.Context) {
+	reqAddr, ok := requestAddress(ctx)
+	if !ok {
+		returnError(ctx, ErrInvalidToken, 401)
+		return
+	}
+	if addr := ctx.Params().Get("addr"); addr == "" || reqAddr != addr {
+		returnError(ctx, ErrForbidden, 403)
+		return
+	}
+	ctx.Next()
+}
+
+// tokenClaims returns the claims of the token validated by authenticate
+func tokenClaims(ctx iris.Context) (jwt.MapClaims, bool) {
+	token, ok := ctx.Values().Get(jwtContextKey).(*jwt.Token)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return claims, ok
+}
+
+// isReadOnly tells if claims are of a session opened with a signature
+func isReadOnly(claims jwt.MapClaims) bool {
+	readOnly, _ := claims[readOnlyClaim].(bool)
+	return readOnly
+}
+
+func (s *Server) checkClaims(claims jwt.MapClaims, typ string) error {
+	if claims[typeClaim] != typ {
+		return fmt.Errorf("%w: %s token expected", ErrInvalidToken, typ)
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	}
+	for _, name := range []string{addressClaim, jtiClaim, sidClaim} {
+		if v, _ := claims[name].(string); v == "" {
+			return fmt.Errorf("%w: missing %s claim", ErrInvalidToken, name)
+		}
+	}
+	for _, name := range []string{sidClaim, jtiClaim} {
+		revoked, er := s.revocations.IsRevoked(claims[name].(string))
+		if er != nil {
+			return er
+		}
+		if revoked {
+			return fmt.Errorf("%w: token was revoked", ErrInvalidToken)
+		}
+	}
+	iat, _ := claims[iatClaim].(float64)
+	revoked, er := s.revocations.IsRevokedAt(claims[addressClaim].(string), time.UnixMicro(int64(math.Round(iat*1e6))))
+	if er != nil {
+		return er
+	}
+	if revoked {
+		return fmt.Errorf("%w: token was revoked", ErrInvalidToken)
+	}
+	return nil
+}
+
+// issuedAt returns the iat claim of a token issued at now. It keeps the microseconds (a NumericDate can have a
+// fraction), so the revocations by issue time can tell apart the tokens issued in the same second.
+func issuedAt(now time.Time) float64 {
+	return float64(now.UnixMicro()) / 1e6
+}
+
+func newTokenId() (string, error) {
+	b := make([]byte, 16)
+	if _, er := rand.Read(b); er != nil {
+		return "", er
+	}
+	return hex.EncodeToString(b), nil
+}
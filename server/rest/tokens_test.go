@@ -0,0 +1,171 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tokens", func() {
+	ts := withTestServer()
+
+	Context("issued by login", func() {
+		const addr = "addr"
+		var app *iris.Application
+
+		BeforeEach(func() {
+			app = guardedApp(ts.srv)
+		})
+
+		It("Should be accepted by authenticate only as an access token of the {addr} address", func() {
+			before := time.Now()
+			tokens, er := ts.srv.issueTokens(addr, "sid", false)
+			Expect(er).To(BeNil())
+			Expect(tokens.ExpiresAt).To(BeNumerically("~", before.Add(time.Minute).Unix(), 1))
+
+			Expect(do(app, http.MethodPost, "/write/"+addr, tokens.Token, "").Code).To(Equal(200))
+			Expect(do(app, http.MethodGet, "/read/"+addr, tokens.Token, "").Code).To(Equal(200))
+
+			rec := do(app, http.MethodPost, "/write/"+addr, tokens.RefreshToken, "")
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring("access token expected"))
+			Expect(do(app, http.MethodPost, "/write/"+addr, "", "").Code).To(Equal(401))
+
+			rec = do(app, http.MethodPost, "/write/other", tokens.Token, "")
+			Expect(rec.Code).To(Equal(403))
+			Expect(rec.Body.String()).To(ContainSubstring(ErrForbidden.Error()))
+		})
+
+		It("Should only be accepted by refresh as a refresh token", func() {
+			tokens, er := ts.srv.issueTokens(addr, "sid", false)
+			Expect(er).To(BeNil())
+
+			claims, er := ts.srv.parseToken(tokens.RefreshToken, refreshToken)
+			Expect(er).To(BeNil())
+			Expect(claims[addressClaim]).To(Equal(addr))
+			Expect(claims[sidClaim]).To(Equal("sid"))
+
+			_, er = ts.srv.parseToken(tokens.Token, refreshToken)
+			Expect(errors.Is(er, ErrInvalidToken)).To(BeTrue())
+		})
+
+		It("Should be refused once expired", func() {
+			token, er := ts.srv.signToken(addr, "sid", accessToken, false, time.Now().Add(-2*time.Minute), time.Minute)
+			Expect(er).To(BeNil())
+			_, er = ts.srv.parseToken(token, accessToken)
+			Expect(errors.Is(er, ErrInvalidToken)).To(BeTrue())
+			Expect(do(app, http.MethodPost, "/write/"+addr, token, "").Code).To(Equal(401))
+		})
+
+		It("Should be refused once revoked by its id, its session or its issue time", func() {
+			tokens, er := ts.srv.issueTokens(addr, "sid", false)
+			Expect(er).To(BeNil())
+			claims, er := ts.srv.parseToken(tokens.Token, accessToken)
+			Expect(er).To(BeNil())
+			Expect(ts.srv.revokeToken(claims)).To(Succeed())
+			Expect(do(app, http.MethodPost, "/write/"+addr, tokens.Token, "").Code).To(Equal(401))
+			_, er = ts.srv.parseToken(tokens.RefreshToken, refreshToken)
+			Expect(er).To(BeNil())
+
+			Expect(ts.srv.revokeSession(claims)).To(Succeed())
+			_, er = ts.srv.parseToken(tokens.RefreshToken, refreshToken)
+			Expect(errors.Is(er, ErrInvalidToken)).To(BeTrue())
+			other, er := ts.srv.issueTokens(addr, "other", false)
+			Expect(er).To(BeNil())
+			Expect(do(app, http.MethodPost, "/write/"+addr, other.Token, "").Code).To(Equal(200))
+
+			Expect(ts.srv.revocations.RevokeIssuedBefore(addr, time.Now())).To(Succeed())
+			Expect(do(app, http.MethodPost, "/write/"+addr, other.Token, "").Code).To(Equal(401))
+			after, er := ts.srv.issueTokens(addr, "after", false)
+			Expect(er).To(BeNil())
+			Expect(do(app, http.MethodPost, "/write/"+addr, after.Token, "").Code).To(Equal(200))
+		})
+
+		It("Should be refused if not signed with the secret of the server", func() {
+			other := &Server{secret: "other"}
+			token, er := other.signToken(addr, "sid", accessToken, false, time.Now(), time.Minute)
+			Expect(er).To(BeNil())
+			_, er = ts.srv.parseToken(token, accessToken)
+			Expect(errors.Is(er, ErrInvalidToken)).To(BeTrue())
+			Expect(do(app, http.MethodPost, "/write/"+addr, token, "").Code).To(Equal(401))
+		})
+	})
+
+	Context("of a session opened with a signature", func() {
+		const addr = "addr"
+		var readOnly string
+
+		BeforeEach(func() {
+			tokens, er := ts.srv.issueTokens(addr, "sid", true)
+			Expect(er).To(BeNil())
+			readOnly = tokens.Token
+		})
+
+		It("Should be refused by every route not only reading the data of the address", func() {
+			// the routes answering without a token, and the ones also open to the read only tokens
+			open := map[string]bool{
+				"POST /api/v1/login":                             true,
+				"POST /api/v1/challenge":                         true,
+				"POST /api/v1/refresh":                           true,
+				"GET /api/v1/:addr/publications":                 true,
+				"GET /api/v1/:addr/publications/:key":            true,
+				"GET /api/v1/:addr/publications/:key/:connector": true,
+				"GET /api/v1/media":                              true,
+				"POST /api/v1/logout":                            true,
+				"GET /api/v1/:addr/subscriptions":                true,
+				"GET /api/v1/:addr/subscriptions/publications":   true,
+			}
+			param := regexp.MustCompile(`:\w+`)
+			refused := 0
+			for _, r := range ts.app.GetRoutes() {
+				route := r.Method + " " + r.Path
+				if !strings.HasPrefix(r.Path, basePath) || open[route] {
+					continue
+				}
+				path := param.ReplaceAllStringFunc(r.Path, func(p string) string {
+					if p == ":addr" {
+						return addr
+					}
+					return "x"
+				})
+				rec := do(ts.app, r.Method, path, readOnly, "{}")
+				Expect(rec.Code).To(Equal(403), route)
+				Expect(rec.Body.String()).To(ContainSubstring(ErrReadOnlySession.Error()), route)
+				refused++
+			}
+			Expect(refused).To(Equal(len(ts.app.GetRoutes()) - len(open)))
+		})
+
+		It("Should be accepted by the routes reading the data of the address", func() {
+			app := guardedApp(ts.srv)
+
+			Expect(do(app, http.MethodGet, "/read/"+addr, readOnly, "").Code).To(Equal(200))
+			Expect(do(app, http.MethodGet, "/scope/"+addr, readOnly, "").Code).To(Equal(200))
+			Expect(do(app, http.MethodPost, "/write/"+addr, readOnly, "").Code).To(Equal(403))
+
+			tokens, er := ts.srv.issueTokens(addr, "sid2", false)
+			Expect(er).To(BeNil())
+			Expect(do(app, http.MethodPost, "/write/"+addr, tokens.Token, "").Code).To(Equal(200))
+		})
+
+		It("Should carry the read only claim in the refresh token too, which refresh passes on", func() {
+			tokens, er := ts.srv.issueTokens(addr, "sid", true)
+			Expect(er).To(BeNil())
+			claims, er := ts.srv.parseToken(tokens.RefreshToken, refreshToken)
+			Expect(er).To(BeNil())
+			Expect(isReadOnly(claims)).To(BeTrue())
+
+			tokens, er = ts.srv.issueTokens(addr, "sid", false)
+			Expect(er).To(BeNil())
+			claims, er = ts.srv.parseToken(tokens.RefreshToken, refreshToken)
+			Expect(er).To(BeNil())
+			Expect(isReadOnly(claims)).To(BeFalse())
+		})
+	})
+})
@@ -2,9 +2,20 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/ipfs/kubo/core"
 	"github.com/ipfs/kubo/core/coreapi"
 	icore "github.com/ipfs/kubo/core/coreiface"
 	"github.com/iris-contrib/middleware/cors"
@@ -12,11 +23,13 @@ import (
 	"github.com/kataras/iris/v12/middleware/logger"
 	"github.com/kataras/iris/v12/middleware/recover"
 	"github.com/kataras/iris/v12/sessions"
+	"github.com/prometheus/client_golang/prometheus"
 	bolt "go.etcd.io/bbolt"
 	"go.uber.org/zap"
 
 	"github.com/msaldanha/setinstone/event"
 
+	"github.com/msaldanha/pulpit/metrics"
 	"github.com/msaldanha/pulpit/server/ipfs"
 	"github.com/msaldanha/pulpit/server/rest"
 	"github.com/msaldanha/pulpit/server/web"
@@ -24,18 +37,53 @@ import (
 )
 
 const (
-	dbFile          = ".pulpit.db"
-	subsBucket      = "subscriptions"
-	addressesBucket = "addresses"
-	nameSpace       = "pulpit"
+	dbFile            = ".pulpit.db"
+	subsBucket        = "subscriptions"
+	addressesBucket   = "addresses"
+	settingsBucket    = "settings"
+	revocationsBucket = "revoked_tokens"
+	lockoutBucket     = "failed_logins"
+	apiKeysBucket     = "api_keys"
+	secretKey         = "jwt_secret"
+	secretSize        = 32
+	nameSpace         = "pulpit"
 )
 
 type Options struct {
-	Url             string
-	DataStore       string
-	IpfsPort        string
-	IpfsApiPort     string
-	IpfsGatewayPort string
+	Url             string        `toml:"url" flag:"url" usage:"Listening address. Should have the form of [host]:port, i.e localhost:8080 or :8080"`
+	DataStore       string        `toml:"data" flag:"data" usage:"Data Store file"`
+	Secret          string        `toml:"secret" usage:"Secret used to sign the JWTs. If empty, a random one is generated and kept in the data store"`
+	TokenTTL        time.Duration `toml:"token_ttl" flag:"tokenttl" usage:"Lifetime of the access tokens"`
+	RefreshTokenTTL time.Duration `toml:"refresh_token_ttl" flag:"refreshtokenttl" usage:"Lifetime of the refresh tokens"`
+	KeyIdleTimeout  time.Duration `toml:"key_idle_timeout" flag:"keyidletimeout" usage:"Time after which an unused private key is locked and must be unlocked with its password again. 0 disables it"`
+	LoginRate       string        `toml:"login_rate" flag:"loginrate" usage:"Rate limit of the logins per client IP and per address, as <count>/<period>. Empty disables it"`
+	AddressRate     string        `toml:"address_rate" flag:"addressrate" usage:"Rate limit of the address creations per client IP and per address, as <count>/<period>. Empty disables it"`
+	PostRate        string        `toml:"post_rate" flag:"postrate" usage:"Rate limit of the posts per client IP and per address, as <count>/<period>. Empty disables it"`
+	MediaRate       string        `toml:"media_rate" flag:"mediarate" usage:"Rate limit of the media uploads per client IP and per address, as <count>/<period>. Empty disables it"`
+	LoginAttempts   int           `toml:"login_attempts" flag:"loginattempts" usage:"Failed logins of an address before it is locked out. 0 disables the lockout"`
+	LoginLockout    time.Duration `toml:"login_lockout" flag:"loginlockout" usage:"Lockout after -loginattempts failed logins, doubled on every further failure"`
+	LoginLockoutMax time.Duration `toml:"login_lockout_max" flag:"loginlockoutmax" usage:"Maximum lockout after failed logins"`
+	Admins          []string      `toml:"admins" flag:"admins" usage:"Comma separated list of the local addresses allowed to use the admin API"`
+	LogLevel        string        `toml:"log_level" flag:"loglevel" usage:"Log level: debug, info, warn, error or fatal"`
+	CorsOrigins     []string      `toml:"cors_origins" flag:"corsorigins" usage:"Comma separated list of allowed CORS origins"`
+	ReadTimeout     time.Duration `toml:"read_timeout" flag:"readtimeout" usage:"HTTP read timeout"`
+	WriteTimeout    time.Duration `toml:"write_timeout" flag:"writetimeout" usage:"HTTP write timeout"`
+	IdleTimeout     time.Duration `toml:"idle_timeout" flag:"idletimeout" usage:"HTTP keep-alive idle timeout"`
+	MediaTimeout    time.Duration `toml:"media_timeout" flag:"mediatimeout" usage:"Timeout for fetching media from IPFS"`
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout" flag:"shutdowntimeout" usage:"Time allowed for a graceful shutdown"`
+	TLSCert         string        `toml:"tls_cert" flag:"tlscert" usage:"TLS certificate file. Enables HTTPS on -url"`
+	TLSKey          string        `toml:"tls_key" flag:"tlskey" usage:"TLS key file"`
+	TLSSelfSigned   bool          `toml:"tls_self_signed" flag:"tlsselfsigned" usage:"Enables HTTPS on -url with a generated self-signed certificate (for development only)"`
+	UnixSocket      string        `toml:"unix_socket" flag:"unixsocket" usage:"Unix domain socket to listen on, in addition to -url. Set -url to empty to listen only on the socket"`
+	IpfsPort        string        `toml:"ipfs_port" flag:"ipfsport" usage:"IPFS port number"`
+	IpfsApiPort     string        `toml:"ipfs_api_port" flag:"ipfsapiport" usage:"IPFS API port number"`
+	IpfsGatewayPort string        `toml:"ipfs_gateway_port" flag:"ipfsgatewayport" usage:"IPFS Gateway port number"`
+	IpfsRepo        string        `toml:"ipfs_repo" flag:"ipfsrepo" usage:"IPFS repo directory. If empty, a temporary repo is used and discarded on exit"`
+	IpfsBootstrap   []string      `toml:"ipfs_bootstrap" flag:"ipfsbootstrap" usage:"Comma separated list of IPFS bootstrap peers. If empty, the public bootstrap nodes are used (unless -ipfslan is set)"`
+	IpfsSwarm       []string      `toml:"ipfs_swarm" flag:"ipfsswarm" usage:"Comma separated list of IPFS swarm listening addresses. If empty, all interfaces are used on -ipfsport"`
+	IpfsAnnounce    []string      `toml:"ipfs_announce" flag:"ipfsannounce" usage:"Comma separated list of IPFS addresses to announce to peers"`
+	IpfsLanMode     bool          `toml:"ipfs_lan" flag:"ipfslan" usage:"LAN mode: only connect to the peers in -ipfsbootstrap and the ones found by mDNS"`
+	IpfsMdns        bool          `toml:"ipfs_mdns" flag:"ipfsmdns" usage:"Enable mDNS peer discovery"`
 }
 
 type Response struct {
@@ -47,6 +95,7 @@ type Server struct {
 	opts       Options
 	store      service.KeyValueStore
 	ipfs       icore.CoreAPI
+	node       *core.IpfsNode
 	evmf       event.ManagerFactory
 	ps         *service.PulpitService
 	secret     string
@@ -54,93 +103,286 @@ type Server struct {
 	ipfsServer *ipfs.IpfsServer
 	db         *bolt.DB
 	app        *iris.Application
+	collector  *metrics.NodeCollector
+	tlsConfig  *tls.Config
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+	stopping     atomic.Bool
 }
 
-func NewServer(opts Options) (*Server, error) {
-	logger, er := zap.NewProduction()
-	if er != nil {
+// NewServer sets up the whole server stack. On failure, it returns a *StartupError telling which phase failed and
+// releases everything that was already started.
+func NewServer(opts Options) (srv *Server, er error) {
+	if er = opts.Validate(); er != nil {
 		return nil, er
 	}
 
+	logCfg := zap.NewProductionConfig()
+	logCfg.Level, er = zap.ParseAtomicLevel(opts.LogLevel)
+	if er != nil {
+		return nil, newStartupError(ErrLoggerStartup, er)
+	}
+	logger, er := logCfg.Build()
+	if er != nil {
+		return nil, newStartupError(ErrLoggerStartup, er)
+	}
+
+	tlsConfig, er := loadTLSConfig(opts, logger)
+	if er != nil {
+		return nil, newStartupError(ErrTLSStartup, er)
+	}
+
+	// cleanups of the phases already done, run in reverse order if a later phase fails
+	var cleanups []func()
+	defer func() {
+		if er == nil {
+			return
+		}
+		logger.Error("server startup failed", zap.Error(er))
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+		_ = logger.Sync()
+	}()
+
 	ipfsServer := ipfs.NewIpfsServer(logger, ipfs.ServerOptions{
 		IpfsPort:        opts.IpfsPort,
 		IpfsApiPort:     opts.IpfsApiPort,
 		IpfsGatewayPort: opts.IpfsGatewayPort,
+		RepoPath:        opts.IpfsRepo,
+		Bootstrap:       opts.IpfsBootstrap,
+		SwarmAddrs:      opts.IpfsSwarm,
+		AnnounceAddrs:   opts.IpfsAnnounce,
+		LanMode:         opts.IpfsLanMode,
+		Mdns:            opts.IpfsMdns,
 	})
 
 	ctx := context.Background()
-	node, er := ipfsServer.SpawnEphemeral(ctx)
+	var node *core.IpfsNode
+	if opts.IpfsRepo != "" {
+		node, er = ipfsServer.SpawnPersistent(ctx)
+	} else {
+		node, er = ipfsServer.SpawnEphemeral(ctx)
+	}
 	if er != nil {
-		panic(fmt.Errorf("failed to spawn ephemeral node: %s", er))
+		_ = ipfsServer.Stop()
+		return nil, newStartupError(ErrIpfsStartup, er)
 	}
-	fmt.Println("IPFS node is running")
+	cleanups = append(cleanups, func() {
+		_ = ipfsServer.Stop()
+	})
+	logger.Info("IPFS node is running")
+
 	// Attach the Core API to the node
 	ipfs, er := coreapi.NewCoreAPI(node)
 	if er != nil {
-		panic(fmt.Errorf("failed to get ipfs api: %s", er))
+		return nil, newStartupError(ErrIpfsStartup, er)
 	}
 
 	evmf, er := event.NewManagerFactory(nameSpace, ipfs.PubSub(), node.Identity)
 	if er != nil {
-		panic(fmt.Errorf("failed to setup event manager factory: %s", er))
+		return nil, newStartupError(ErrEventManagerStartup, er)
+	}
+	cleanups = append(cleanups, func() {
+		if closer, ok := evmf.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	})
+
+	db, er := OpenDataStore(opts.DataStore)
+	if er != nil {
+		return nil, newStartupError(ErrDbStartup, er)
 	}
+	cleanups = append(cleanups, func() {
+		_ = db.Close()
+	})
 
-	db, er := bolt.Open(opts.DataStore, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	migrated, er := Migrate(db, opts.DataStore, false)
 	if er != nil {
-		panic(fmt.Errorf("failed to setup DB: %s", er))
+		return nil, newStartupError(ErrDbStartup, er)
+	}
+	if len(migrated.Pending) > 0 {
+		logger.Info("data file migrated", zap.Int("from", migrated.From), zap.Int("to", migrated.To),
+			zap.String("backup", migrated.Backup))
+	}
+
+	secret := opts.Secret
+	if secret == "" {
+		secret, er = LoadOrCreateSecret(db)
+		if er != nil {
+			return nil, newStartupError(ErrDbStartup, er)
+		}
 	}
 
-	addressStore := service.NewBoltKeyValueStore(db, addressesBucket)
+	lockout := NewLoginLockout(db, opts.LoginAttempts, opts.LoginLockout, opts.LoginLockoutMax)
 
-	subsStore, er := service.NewSubscriptionsStore(db, subsBucket)
+	revocations := NewRevocations(db)
+	if _, er = revocations.Purge(time.Now()); er != nil {
+		return nil, newStartupError(ErrDbStartup, er)
+	}
+
+	addressStore := NewAddressStore(db)
+
+	subsStore, er := NewSubscriptionsStore(db)
 	if er != nil {
-		panic(fmt.Errorf("failed to setup subscriptions DB: %s", er))
+		return nil, newStartupError(ErrDbStartup, er)
 	}
 
-	ps := service.NewPulpitService(nameSpace, addressStore, ipfs, node, evmf, logger, subsStore, db)
+	ps := service.NewPulpitService(nameSpace, addressStore, ipfs, node, evmf, logger, subsStore, db, opts.KeyIdleTimeout,
+		lockout, NewApiKeys(db))
 
-	app := NewWebApplication()
-	web.ConfigureWebServer(app, ps)
-	rest.ConfigureApiServer(app, ps)
+	app := NewWebApplication(opts)
+	web.ConfigureWebServer(app, ps, secret, rest.LimitIP(rateLimit(opts.LoginRate)))
+	rest.ConfigureApiServer(app, rest.Options{
+		PulpitService:   ps,
+		Logger:          logger,
+		Secret:          secret,
+		MediaTimeout:    opts.MediaTimeout,
+		TokenTTL:        opts.TokenTTL,
+		RefreshTokenTTL: opts.RefreshTokenTTL,
+		Revocations:     revocations,
+		Admins:          opts.Admins,
+		LoginRate:       rateLimit(opts.LoginRate),
+		AddressRate:     rateLimit(opts.AddressRate),
+		PostRate:        rateLimit(opts.PostRate),
+		MediaRate:       rateLimit(opts.MediaRate),
+	})
 
-	return &Server{
+	srv = &Server{
 		opts:       opts,
 		store:      addressStore,
 		ipfs:       ipfs,
+		node:       node,
 		evmf:       evmf,
 		ps:         ps,
-		secret:     "",
+		secret:     secret,
 		logger:     logger,
 		ipfsServer: ipfsServer,
 		db:         db,
 		app:        app,
-	}, nil
+		tlsConfig:  tlsConfig,
+	}
+	srv.configureHealthHandlers()
+	if er = srv.configureMetrics(); er != nil {
+		return nil, newStartupError(ErrMetricsStartup, er)
+	}
+
+	return srv, nil
 }
 
+// Run serves the web app until a SIGINT/SIGTERM is received or Shutdown is called. On a signal the whole stack is
+// shut down within ShutdownTimeout.
 func (s *Server) Run() error {
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s.app.Configure(iris.WithoutInterruptHandler, iris.WithoutServerError(iris.ErrServerClosed))
+	if err := s.app.Build(); err != nil {
+		_ = s.shutdownWithTimeout()
+		return err
+	}
+
+	listeners, err := s.listen()
+	if err != nil {
+		_ = s.shutdownWithTimeout()
+		return err
+	}
+
 	wg := &ChannelWaitGroup{}
-	wg.Add(1)
-	errCh := make(chan error, 1)
-	go func() {
-		defer wg.Done()
-		if err := s.app.Run(iris.Addr(s.opts.Url)); err != nil {
+	wg.Add(len(listeners))
+	errCh := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			defer wg.Done()
+			srv := &http.Server{
+				Addr:         l.Addr().String(),
+				ReadTimeout:  s.opts.ReadTimeout,
+				WriteTimeout: s.opts.WriteTimeout,
+				IdleTimeout:  s.opts.IdleTimeout,
+			}
+			err := s.app.NewHost(srv).Serve(l)
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
 			errCh <- err
-		}
-	}()
+		}(l)
+	}
 
 	select {
-	case <-wg.Wait():
-		return nil
+	case <-sigCtx.Done():
+		s.logger.Info("shutdown signal received")
+		return s.shutdownWithTimeout()
 	case err := <-errCh:
-		return err
+		// either Shutdown was called or a listener failed
+		if err != nil {
+			_ = s.shutdownWithTimeout()
+			return err
+		}
+		<-wg.Wait()
+		return nil
+	}
+}
+
+// Shutdown stops the whole stack in order: drains the in-flight HTTP requests, stops the timelines, closes the
+// event manager factory, the DB and the IPFS node. It is safe to call it more than once.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown(ctx)
+	})
+	return s.shutdownErr
+}
 
+func (s *Server) shutdownWithTimeout() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+func (s *Server) shutdown(ctx context.Context) error {
+	var errs []error
+	s.stopping.Store(true)
+
+	if er := s.app.Shutdown(ctx); er != nil {
+		errs = append(errs, fmt.Errorf("failed to shutdown http server: %w", er))
 	}
 
+	prometheus.Unregister(s.collector)
+
+	s.ps.Close()
+
+	if closer, ok := s.evmf.(io.Closer); ok {
+		if er := closer.Close(); er != nil {
+			errs = append(errs, fmt.Errorf("failed to close event manager factory: %w", er))
+		}
+	}
+
+	if er := s.db.Close(); er != nil {
+		errs = append(errs, fmt.Errorf("failed to close DB: %w", er))
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ipfsServer.Stop()
+	}()
+	select {
+	case er := <-done:
+		if er != nil {
+			errs = append(errs, fmt.Errorf("failed to stop ipfs node: %w", er))
+		}
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("failed to stop ipfs node: %w", ctx.Err()))
+	}
+
+	s.logger.Info("server stopped")
+	_ = s.logger.Sync()
+
+	return errors.Join(errs...)
 }
 
-func NewWebApplication() *iris.Application {
+func NewWebApplication(opts Options) *iris.Application {
 	app := iris.New()
-	app.Logger().SetLevel("debug")
+	app.Logger().SetLevel(opts.LogLevel)
 	app.Use(recover.New())
 	app.Use(logger.New())
 
@@ -148,7 +390,7 @@ func NewWebApplication() *iris.Application {
 	app.Use(sess.Handler())
 
 	crs := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowedOrigins:   opts.CorsOrigins,
 		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: true,
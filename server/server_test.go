@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var dir, wd string
+	var opts Options
+
+	BeforeEach(func() {
+		var er error
+		dir, er = os.MkdirTemp("", "pulpit-server")
+		Expect(er).To(BeNil())
+		// the web views are loaded from the working directory, which must be the root of the repo
+		wd, er = os.Getwd()
+		Expect(er).To(BeNil())
+		Expect(os.Chdir("..")).To(Succeed())
+
+		// an offline node, only listening on a unix socket
+		opts = DefaultOptions()
+		opts.Url = ""
+		opts.UnixSocket = filepath.Join(dir, "pulpit.sock")
+		opts.DataStore = filepath.Join(dir, "pulpit.dat")
+		opts.LogLevel = "error"
+		opts.IpfsPort = "0"
+		opts.IpfsApiPort = "0"
+		opts.IpfsGatewayPort = "0"
+		opts.IpfsLanMode = true
+		opts.IpfsMdns = false
+	})
+
+	AfterEach(func() {
+		_ = os.Chdir(wd)
+		_ = os.RemoveAll(dir)
+	})
+
+	// client talks to the server over its unix socket
+	client := func() *http.Client {
+		return &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", opts.UnixSocket)
+				},
+			},
+		}
+	}
+
+	get := func(path string) (int, error) {
+		resp, er := client().Get("http://pulpit" + path)
+		if er != nil {
+			return 0, er
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	// serve runs srv until the returned function is called, once it answers on the socket
+	serve := func(srv *Server) (stop func()) {
+		done := make(chan error, 1)
+		go func() {
+			done <- srv.Run()
+		}()
+		Eventually(func() error {
+			_, er := get(healthPath)
+			return er
+		}, 5*time.Second).Should(Succeed())
+		return func() {
+			Expect(srv.Shutdown(context.Background())).To(Succeed())
+			Eventually(done, 5*time.Second).Should(Receive(BeNil()))
+		}
+	}
+
+	It("Should tell it is alive and ready until it is stopping", func() {
+		srv, er := NewServer(opts)
+		Expect(er).To(BeNil())
+		defer serve(srv)()
+
+		resp, er := client().Get("http://pulpit" + healthPath)
+		Expect(er).To(BeNil())
+		report := HealthReport{}
+		Expect(json.NewDecoder(resp.Body).Decode(&report)).To(Succeed())
+		_ = resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(report.Ipfs.Status).To(Equal(statusOk))
+		Expect(report.Ipfs.Online).To(BeTrue())
+		Expect(report.DB.Status).To(Equal(statusOk))
+
+		Expect(get(readyPath)).To(Equal(200))
+		srv.stopping.Store(true)
+		Expect(get(readyPath)).To(Equal(503))
+		Expect(get(healthPath)).To(Equal(200))
+	})
+
+	It("Should export the metrics of the node and of the api requests", func() {
+		srv, er := NewServer(opts)
+		Expect(er).To(BeNil())
+		defer serve(srv)()
+
+		resp, er := client().Post("http://pulpit/api/v1/login", "application/json", strings.NewReader("{}"))
+		Expect(er).To(BeNil())
+		_ = resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(400))
+
+		resp, er = client().Get("http://pulpit" + metricsPath)
+		Expect(er).To(BeNil())
+		body, er := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		Expect(er).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(string(body)).To(ContainSubstring(`pulpit_logins_active{node_id="` + srv.node.Identity.String() + `"} 0`))
+		Expect(string(body)).To(MatchRegexp(`pulpit_http_requests_total\{code="400",method="POST",route="/api/v1/login"\} \d+`))
+	})
+
+	It("Should serve until Shutdown and then release the whole stack", func() {
+		srv, er := NewServer(opts)
+		Expect(er).To(BeNil())
+		serve(srv)()
+		_, er = get(healthPath)
+		Expect(er).NotTo(BeNil())
+
+		// the data file is closed, so it can be opened again
+		db, er := OpenDataStore(opts.DataStore)
+		Expect(er).To(BeNil())
+		Expect(db.Close()).To(Succeed())
+
+		Expect(srv.Shutdown(context.Background())).To(Succeed())
+	})
+
+	It("Should fail with the startup error of the phase that failed", func() {
+		tlsOpts := opts
+		tlsOpts.TLSCert = filepath.Join(dir, "missing.pem")
+		tlsOpts.TLSKey = filepath.Join(dir, "missing.key")
+		_, er := NewServer(tlsOpts)
+		startupEr := &StartupError{}
+		Expect(errors.As(er, &startupEr)).To(BeTrue())
+		Expect(errors.Is(er, ErrTLSStartup)).To(BeTrue())
+		Expect(errors.Is(er, os.ErrNotExist)).To(BeTrue())
+
+		ipfsOpts := opts
+		ipfsOpts.IpfsBootstrap = []string{"not a multiaddr"}
+		_, er = NewServer(ipfsOpts)
+		Expect(errors.Is(er, ErrIpfsStartup)).To(BeTrue())
+
+		invalid := opts
+		invalid.DataStore = ""
+		_, er = NewServer(invalid)
+		Expect(errors.Is(er, ErrInvalidOptions)).To(BeTrue())
+		Expect(errors.As(er, &startupEr)).To(BeFalse())
+	})
+
+	It("Should release what was started when a later phase fails", func() {
+		opts.IpfsRepo = filepath.Join(dir, "repo")
+		dbOpts := opts
+		dbOpts.DataStore = filepath.Join(dir, "missing", "pulpit.dat")
+		_, er := NewServer(dbOpts)
+		Expect(errors.Is(er, ErrDbStartup)).To(BeTrue())
+
+		// the ipfs repo was unlocked
+		srv, er := NewServer(opts)
+		Expect(er).To(BeNil())
+		Expect(srv.Shutdown(context.Background())).To(Succeed())
+	})
+})
@@ -84,11 +84,11 @@ func (c *AuthController) isLoggedIn() bool {
 	return c.Address != ""
 }
 
-// if logged in then destroy the session
-// and redirect to the login page
-// otherwise redirect to the registration page.
+// if logged in then ends the service session of the address, destroy the session
+// and redirect to the login page.
 func (c *AuthController) logout() mvc.Response {
 	if c.isLoggedIn() {
+		_ = c.Service.Logout(c.ctx, c.Address)
 		c.Session.Destroy()
 	}
 	return PathLogin
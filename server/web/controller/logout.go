@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"github.com/kataras/iris/v12/mvc"
+)
+
+type LogoutController struct {
+	AuthController
+}
+
+func (c *LogoutController) Get() mvc.Result {
+	return c.logout()
+}
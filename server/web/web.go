@@ -1,8 +1,6 @@
 package web
 
 import (
-	"os"
-
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/mvc"
 
@@ -12,29 +10,39 @@ import (
 
 const basePath = "/mvc"
 
-func ConfigureWebServer(app *iris.Application, service *service.PulpitService) {
+// ConfigureWebServer registers the web pages. loginLimit guards the login form posts.
+func ConfigureWebServer(app *iris.Application, service *service.PulpitService, secret string, loginLimit iris.Handler) {
 	app.RegisterView(iris.HTML("./server/web/views", ".html").Layout("shared/layout.html").Reload(true))
 
 	app.HandleDir("/public", iris.Dir("./server/web/public"))
 
-	mvc.Configure(app.Party(basePath+"/login"),
-		commonControllerSetupFunc(service, new(controller.LoginController)))
+	login := app.Party(basePath + "/login")
+	login.Use(func(ctx iris.Context) {
+		if ctx.Method() != iris.MethodPost {
+			ctx.Next()
+			return
+		}
+		loginLimit(ctx)
+	})
+	mvc.Configure(login,
+		commonControllerSetupFunc(service, secret, new(controller.LoginController)))
+
+	mvc.Configure(app.Party(basePath+"/logout"),
+		commonControllerSetupFunc(service, secret, new(controller.LogoutController)))
 
 	mvc.Configure(app.Party(basePath+"/subscriptions"),
-		commonControllerSetupFunc(service, new(controller.SubscriptionsController)))
+		commonControllerSetupFunc(service, secret, new(controller.SubscriptionsController)))
 
 	mvc.Configure(app.Party(basePath+"/"),
-		commonControllerSetupFunc(service, new(controller.TimelineController)))
+		commonControllerSetupFunc(service, secret, new(controller.TimelineController)))
 }
 
-func commonControllerSetupFunc(service *service.PulpitService, ctrl interface{}) func(mvcApp *mvc.Application) {
+func commonControllerSetupFunc(service *service.PulpitService, secret string, ctrl interface{}) func(mvcApp *mvc.Application) {
 	return func(mvcApp *mvc.Application) {
 		// Register Dependencies.
-		var secret controller.Secret
-		secret = controller.Secret(os.Getenv("SERVER_SECRET"))
 		mvcApp.Register(
 			service,
-			secret,
+			controller.Secret(secret),
 		)
 
 		// Register Controllers.
@@ -2,32 +2,136 @@ package service
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
 
 	xdr "github.com/davecgh/go-xdr/xdr2"
 
 	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/crypto"
 )
 
 const bookmarkFlag = "Bookmarkflag"
 
+// The versions of the AddressRecord format. The legacy records have no version: their private key is encrypted
+// directly with the password by crypto.Encrypt.
+const (
+	legacyRecordVersion  = 0
+	addressRecordVersion = 1
+)
+
+// recordMagic starts the versioned records. A legacy record starts with the XDR length of the address, so it can
+// never start with it.
+var recordMagic = []byte("PULPITAR")
+
+// AddressRecord is the stored form of a local address. Since version 1, the private key and the bookmark are
+// encrypted with AES-GCM using a key derived from the password with Kdf.
 type AddressRecord struct {
+	Version  uint32
+	Address  address.Address
+	Bookmark []byte
+	Kdf      KdfParams
+}
+
+// legacyAddressRecord is the layout of the records without version
+type legacyAddressRecord struct {
 	Address  address.Address
 	Bookmark []byte
 }
 
-func (a *AddressRecord) ToBytes() []byte {
+// newAddressRecord returns the record of addr, with its private key encrypted with pass
+func newAddressRecord(addr *address.Address, pass string) (*AddressRecord, error) {
+	kdf, er := newKdfParams()
+	if er != nil {
+		return nil, er
+	}
+	key, er := kdf.deriveKey(pass)
+	if er != nil {
+		return nil, er
+	}
+	privKey, er := seal(key, []byte(addr.Keys.PrivateKey))
+	if er != nil {
+		return nil, er
+	}
+	bookmark, er := seal(key, []byte(bookmarkFlag))
+	if er != nil {
+		return nil, er
+	}
+
+	dbAddress := addr.Clone()
+	dbAddress.Keys.PrivateKey = hex.EncodeToString(privKey)
+	return &AddressRecord{
+		Version:  addressRecordVersion,
+		Address:  *dbAddress,
+		Bookmark: bookmark,
+		Kdf:      kdf,
+	}, nil
+}
+
+// NeedsUpgrade tells if the record is in an older format than the current one
+func (a *AddressRecord) NeedsUpgrade() bool {
+	return a.Version < addressRecordVersion
+}
+
+// unlock returns the address of the record with its private key decrypted, ErrInvalidPassword if pass is wrong
+func (a *AddressRecord) unlock(pass string) (*address.Address, error) {
+	decrypt := func(b []byte) ([]byte, error) {
+		return crypto.Decrypt(b, pass)
+	}
+	if a.Version != legacyRecordVersion {
+		key, er := a.Kdf.deriveKey(pass)
+		if er != nil {
+			return nil, er
+		}
+		decrypt = func(b []byte) ([]byte, error) {
+			return open(key, b)
+		}
+	}
+
+	bookmark, er := decrypt(a.Bookmark)
+	if er != nil || string(bookmark) != bookmarkFlag {
+		return nil, ErrInvalidPassword
+	}
+	privKey, er := hex.DecodeString(a.Address.Keys.PrivateKey)
+	if er != nil {
+		return nil, er
+	}
+	pk, er := decrypt(privKey)
+	if er != nil {
+		return nil, er
+	}
+	unlocked := a.Address.Clone()
+	unlocked.Keys.PrivateKey = string(pk)
+	return unlocked, nil
+}
+
+func (a *AddressRecord) ToBytes() ([]byte, error) {
 	var result bytes.Buffer
+	result.Write(recordMagic)
 	encoder := xdr.NewEncoder(&result)
-	count, err := encoder.Encode(a)
-	if err != nil {
-		fmt.Printf("Encoded %d, Error: %s", count, err.Error())
+	if _, er := encoder.Encode(a); er != nil {
+		return nil, fmt.Errorf("failed to encode the record of %s: %w", a.Address.Address, er)
 	}
-	return result.Bytes()
+	return result.Bytes(), nil
 }
 
 func (a *AddressRecord) FromBytes(b []byte) error {
-	decoder := xdr.NewDecoder(bytes.NewReader(b))
-	_, er := decoder.Decode(a)
-	return er
+	if !bytes.HasPrefix(b, recordMagic) {
+		legacy := legacyAddressRecord{}
+		decoder := xdr.NewDecoder(bytes.NewReader(b))
+		if _, er := decoder.Decode(&legacy); er != nil {
+			return er
+		}
+		*a = AddressRecord{Version: legacyRecordVersion, Address: legacy.Address, Bookmark: legacy.Bookmark}
+		return nil
+	}
+
+	decoder := xdr.NewDecoder(bytes.NewReader(b[len(recordMagic):]))
+	if _, er := decoder.Decode(a); er != nil {
+		return er
+	}
+	if a.Version == legacyRecordVersion || a.Version > addressRecordVersion {
+		return fmt.Errorf("unsupported address record version %d", a.Version)
+	}
+	return nil
 }
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	xdr "github.com/davecgh/go-xdr/xdr2"
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// legacyRecordBytes encodes a as the records without version were written, encrypted directly with pass
+func legacyRecordBytes(a *address.Address, pass string) []byte {
+	dbAddress := a.Clone()
+	dbAddress.Keys.PrivateKey = hex.EncodeToString(crypto.Encrypt([]byte(a.Keys.PrivateKey), pass))
+	legacy := legacyAddressRecord{
+		Address:  *dbAddress,
+		Bookmark: crypto.Encrypt([]byte(bookmarkFlag), pass),
+	}
+	var b bytes.Buffer
+	_, er := xdr.NewEncoder(&b).Encode(legacy)
+	Expect(er).To(BeNil())
+	return b.Bytes()
+}
+
+var _ = Describe("AddressRecord", func() {
+	const pass = "pass"
+	var a *address.Address
+
+	BeforeEach(func() {
+		var er error
+		a, er = address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+	})
+
+	It("Should unlock a record after a round trip", func() {
+		ar, er := newAddressRecord(a, pass)
+		Expect(er).To(BeNil())
+		Expect(ar.Address.Keys.PrivateKey).NotTo(ContainSubstring(a.Keys.PrivateKey))
+		b, er := ar.ToBytes()
+		Expect(er).To(BeNil())
+
+		decoded := AddressRecord{}
+		Expect(decoded.FromBytes(b)).To(Succeed())
+		Expect(decoded.Version).To(Equal(uint32(addressRecordVersion)))
+		Expect(decoded.NeedsUpgrade()).To(BeFalse())
+		unlocked, er := decoded.unlock(pass)
+		Expect(er).To(BeNil())
+		Expect(unlocked.Keys.PrivateKey).To(Equal(a.Keys.PrivateKey))
+
+		_, er = decoded.unlock("wrong")
+		Expect(er).To(Equal(ErrInvalidPassword))
+	})
+
+	It("Should decode and unlock a legacy record", func() {
+		decoded := AddressRecord{}
+		Expect(decoded.FromBytes(legacyRecordBytes(a, pass))).To(Succeed())
+		Expect(decoded.Version).To(Equal(uint32(legacyRecordVersion)))
+		Expect(decoded.NeedsUpgrade()).To(BeTrue())
+		unlocked, er := decoded.unlock(pass)
+		Expect(er).To(BeNil())
+		Expect(unlocked.Keys.PrivateKey).To(Equal(a.Keys.PrivateKey))
+
+		_, er = decoded.unlock("wrong")
+		Expect(er).To(Equal(ErrInvalidPassword))
+	})
+
+	It("Should refuse an unknown version", func() {
+		ar, er := newAddressRecord(a, pass)
+		Expect(er).To(BeNil())
+		ar.Version = addressRecordVersion + 1
+		b, er := ar.ToBytes()
+		Expect(er).To(BeNil())
+		Expect(new(AddressRecord).FromBytes(b)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Addresses", func() {
+	const pass = "pass"
+	var store KeyValueStore
+	var addresses *Addresses
+	tb := withTempBolt()
+
+	BeforeEach(func() {
+		store = NewBoltKeyValueStore(tb.db, "addresses")
+		addresses = NewAddresses(store)
+	})
+
+	It("Should upgrade a legacy record to the current format", func() {
+		a, er := address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+		Expect(store.Put(a.Address, legacyRecordBytes(a, pass))).To(Succeed())
+
+		unlocked, er := addresses.Unlock(a.Address, pass)
+		Expect(er).To(BeNil())
+		upgraded, er := addresses.Upgrade(unlocked, pass)
+		Expect(er).To(BeNil())
+		Expect(upgraded).To(BeTrue())
+
+		ar, found, er := addresses.Get(a.Address)
+		Expect(er).To(BeNil())
+		Expect(found).To(BeTrue())
+		Expect(ar.Version).To(Equal(uint32(addressRecordVersion)))
+		unlocked, er = addresses.Unlock(a.Address, pass)
+		Expect(er).To(BeNil())
+		Expect(unlocked.Keys.PrivateKey).To(Equal(a.Keys.PrivateKey))
+
+		upgraded, er = addresses.Upgrade(unlocked, pass)
+		Expect(er).To(BeNil())
+		Expect(upgraded).To(BeFalse())
+	})
+})
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/msaldanha/setinstone/address"
+)
+
+// Addresses manages the address records kept in a KeyValueStore. It does not depend on IPFS, so it can also be
+// used offline (i.e. by the cli).
+type Addresses struct {
+	store KeyValueStore
+}
+
+func NewAddresses(store KeyValueStore) *Addresses {
+	return &Addresses{store: store}
+}
+
+// Create generates a new address and stores it with its private key encrypted with pass
+func (a *Addresses) Create(pass string) (*address.Address, error) {
+	if pass == "" {
+		return nil, fmt.Errorf("password cannot be empty")
+	}
+
+	addr, er := address.NewAddressWithKeys()
+	if er != nil {
+		return nil, er
+	}
+
+	er = a.put(addr, pass)
+	if er != nil {
+		return nil, er
+	}
+
+	return addr, nil
+}
+
+// Get returns the stored record of addr
+func (a *Addresses) Get(addr string) (AddressRecord, bool, error) {
+	ar := AddressRecord{}
+	buf, found, er := a.store.Get(addr)
+	if er != nil || !found {
+		return ar, found, er
+	}
+	er = ar.FromBytes(buf)
+	if er != nil {
+		return ar, false, er
+	}
+	return ar, true, nil
+}
+
+// Unlock returns addr with its private key decrypted
+func (a *Addresses) Unlock(addr, pass string) (*address.Address, error) {
+	ar, found, er := a.Get(addr)
+	if er != nil {
+		return nil, er
+	}
+	if !found {
+		return nil, ErrAddressNotFound
+	}
+	return ar.unlock(pass)
+}
+
+// Upgrade rewrites the record of unlocked (as returned by Unlock with pass) in the current format if it is in an
+// older one. It tells if the record was upgraded.
+func (a *Addresses) Upgrade(unlocked *address.Address, pass string) (bool, error) {
+	ar, found, er := a.Get(unlocked.Address)
+	if er != nil || !found || !ar.NeedsUpgrade() {
+		return false, er
+	}
+	return true, a.put(unlocked, pass)
+}
+
+// ChangePassword re-encrypts the private key of addr with newPass. The record is replaced in a single write, so
+// either the old or the new password is valid at any time.
+func (a *Addresses) ChangePassword(addr, oldPass, newPass string) error {
+	if newPass == "" {
+		return fmt.Errorf("new password cannot be empty")
+	}
+	unlocked, er := a.Unlock(addr, oldPass)
+	if errors.Is(er, ErrAddressNotFound) {
+		return er
+	}
+	if er != nil {
+		return ErrInvalidPassword
+	}
+	return a.put(unlocked, newPass)
+}
+
+// List returns all stored addresses. Private keys are returned encrypted.
+func (a *Addresses) List() ([]*address.Address, error) {
+	all, er := a.store.GetAll()
+	if er != nil {
+		return nil, er
+	}
+	addresses := []*address.Address{}
+	for _, v := range all {
+		ar := AddressRecord{}
+		_ = ar.FromBytes(v)
+		addresses = append(addresses, &ar.Address)
+	}
+	return addresses, nil
+}
+
+func (a *Addresses) Delete(addr string) error {
+	_, found, er := a.store.Get(addr)
+	if er != nil {
+		return er
+	}
+	if !found {
+		return ErrAddressNotFound
+	}
+	return a.store.Delete(addr)
+}
+
+func (a *Addresses) put(addr *address.Address, pass string) error {
+	ar, er := newAddressRecord(addr, pass)
+	if er != nil {
+		return er
+	}
+	b, er := ar.ToBytes()
+	if er != nil {
+		return er
+	}
+	return a.store.Put(ar.Address.Address, b)
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/crypto"
+
+	"github.com/msaldanha/pulpit/models"
+)
+
+// The scopes of an api key
+const (
+	ScopeRead          = "read"
+	ScopePost          = "post"
+	ScopeSubscriptions = "subscriptions"
+)
+
+const (
+	apiKeyIdSize     = 8
+	apiKeySecretSize = 32
+)
+
+var validScopes = []string{ScopeRead, ScopePost, ScopeSubscriptions}
+
+// ApiKeys keeps the api keys in a KeyValueStore. An api key is <id>.<secret>: only the hash of the secret is kept
+// and, for the keys with the post scope, the private key of the address encrypted with the secret, so that the key
+// can sign without the password of the address.
+type ApiKeys struct {
+	store KeyValueStore
+}
+
+type apiKeyRecord struct {
+	models.ApiKey
+	Hash       string `json:"hash"`
+	PrivateKey string `json:"privateKey,omitempty"`
+}
+
+func NewApiKeys(store KeyValueStore) *ApiKeys {
+	return &ApiKeys{store: store}
+}
+
+// Create generates a new api key for a. a must have its private key if scopes has ScopePost. It returns the key,
+// which cannot be retrieved later.
+func (k *ApiKeys) Create(a *address.Address, name string, scopes []string) (models.ApiKey, string, error) {
+	scopes, er := normalizeScopes(scopes)
+	if er != nil {
+		return models.ApiKey{}, "", er
+	}
+
+	b := make([]byte, apiKeyIdSize+apiKeySecretSize)
+	if _, er = rand.Read(b); er != nil {
+		return models.ApiKey{}, "", er
+	}
+	id := hex.EncodeToString(b[:apiKeyIdSize])
+	secret := hex.EncodeToString(b[apiKeyIdSize:])
+
+	rec := apiKeyRecord{
+		ApiKey: models.ApiKey{
+			Id:        id,
+			Address:   a.Address,
+			Name:      name,
+			Scopes:    scopes,
+			CreatedAt: time.Now().Unix(),
+		},
+		Hash: hashApiKeySecret(secret),
+	}
+	if rec.HasScope(ScopePost) {
+		if a.Keys == nil || a.Keys.PrivateKey == "" {
+			return models.ApiKey{}, "", ErrLocked
+		}
+		rec.PrivateKey = hex.EncodeToString(crypto.Encrypt([]byte(a.Keys.PrivateKey), secret))
+	}
+
+	buf, er := json.Marshal(rec)
+	if er != nil {
+		return models.ApiKey{}, "", er
+	}
+	if er = k.store.Put(id, buf); er != nil {
+		return models.ApiKey{}, "", er
+	}
+	return rec.ApiKey, id + "." + secret, nil
+}
+
+// Check returns the api key of key, or ErrInvalidApiKey if it does not exist
+func (k *ApiKeys) Check(key string) (models.ApiKey, error) {
+	rec, _, er := k.check(key)
+	return rec.ApiKey, er
+}
+
+// Unlock returns the api key of key and its address with the private key. The key must have ScopePost.
+func (k *ApiKeys) Unlock(key string) (models.ApiKey, *address.Address, error) {
+	rec, secret, er := k.check(key)
+	if er != nil {
+		return models.ApiKey{}, nil, er
+	}
+	if !rec.HasScope(ScopePost) || rec.PrivateKey == "" {
+		return models.ApiKey{}, nil, fmt.Errorf("%w: the key has no %s scope", ErrInvalidScope, ScopePost)
+	}
+	encrypted, er := hex.DecodeString(rec.PrivateKey)
+	if er != nil {
+		return models.ApiKey{}, nil, er
+	}
+	pk, er := crypto.Decrypt(encrypted, secret)
+	if er != nil {
+		return models.ApiKey{}, nil, er
+	}
+	a, er := addressFromPrivateKey(string(pk))
+	if er != nil {
+		return models.ApiKey{}, nil, er
+	}
+	if a.Address != rec.Address {
+		return models.ApiKey{}, nil, ErrInvalidApiKey
+	}
+	return rec.ApiKey, a, nil
+}
+
+// List returns the api keys of addr
+func (k *ApiKeys) List(addr string) ([]models.ApiKey, error) {
+	recs, er := k.all(addr)
+	if er != nil {
+		return nil, er
+	}
+	keys := []models.ApiKey{}
+	for _, rec := range recs {
+		keys = append(keys, rec.ApiKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt < keys[j].CreatedAt
+	})
+	return keys, nil
+}
+
+// Revoke deletes the api key id of addr
+func (k *ApiKeys) Revoke(addr, id string) error {
+	rec, found, er := k.get(id)
+	if er != nil {
+		return er
+	}
+	if !found || rec.Address != addr {
+		return ErrApiKeyNotFound
+	}
+	return k.store.Delete(id)
+}
+
+// RevokeAll deletes all the api keys of addr
+func (k *ApiKeys) RevokeAll(addr string) error {
+	recs, er := k.all(addr)
+	if er != nil {
+		return er
+	}
+	for _, rec := range recs {
+		if er = k.store.Delete(rec.Id); er != nil {
+			return er
+		}
+	}
+	return nil
+}
+
+func (k *ApiKeys) check(key string) (apiKeyRecord, string, error) {
+	id, secret, ok := strings.Cut(key, ".")
+	if !ok || id == "" || secret == "" {
+		return apiKeyRecord{}, "", ErrInvalidApiKey
+	}
+	rec, found, er := k.get(id)
+	if er != nil {
+		return apiKeyRecord{}, "", er
+	}
+	if !found || subtle.ConstantTimeCompare([]byte(rec.Hash), []byte(hashApiKeySecret(secret))) != 1 {
+		return apiKeyRecord{}, "", ErrInvalidApiKey
+	}
+	return rec, secret, nil
+}
+
+func (k *ApiKeys) get(id string) (apiKeyRecord, bool, error) {
+	rec := apiKeyRecord{}
+	buf, found, er := k.store.Get(id)
+	if er != nil || !found {
+		return rec, found, er
+	}
+	er = json.Unmarshal(buf, &rec)
+	return rec, er == nil, er
+}
+
+func (k *ApiKeys) all(addr string) ([]apiKeyRecord, error) {
+	all, er := k.store.GetAll()
+	if er != nil {
+		return nil, er
+	}
+	recs := []apiKeyRecord{}
+	for _, buf := range all {
+		rec := apiKeyRecord{}
+		if er = json.Unmarshal(buf, &rec); er != nil {
+			return nil, er
+		}
+		if rec.Address == addr {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, nil
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is needed", ErrInvalidScope)
+	}
+	set := map[string]bool{}
+	for _, scope := range scopes {
+		valid := false
+		for _, v := range validScopes {
+			valid = valid || v == scope
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: %q, expected one of %s", ErrInvalidScope, scope, strings.Join(validScopes, ", "))
+		}
+		set[scope] = true
+	}
+	normalized := []string{}
+	for _, v := range validScopes {
+		if set[v] {
+			normalized = append(normalized, v)
+		}
+	}
+	return normalized, nil
+}
+
+func hashApiKeySecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/msaldanha/setinstone/address"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ApiKeys", func() {
+	var keys *ApiKeys
+	var a *address.Address
+	tb := withTempBolt()
+
+	BeforeEach(func() {
+		keys = NewApiKeys(NewBoltKeyValueStore(tb.db, "apikeys"))
+		var er error
+		a, er = address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+	})
+
+	It("Should keep the valid scopes once and in order", func() {
+		k, _, er := keys.Create(a, "bot", []string{ScopeSubscriptions, ScopeRead, ScopeSubscriptions})
+		Expect(er).To(BeNil())
+		Expect(k.Scopes).To(Equal([]string{ScopeRead, ScopeSubscriptions}))
+	})
+
+	It("Should refuse no scope or an unknown one", func() {
+		_, _, er := keys.Create(a, "bot", nil)
+		Expect(er).To(MatchError(ErrInvalidScope))
+		_, _, er = keys.Create(a, "bot", []string{ScopeRead, "admin"})
+		Expect(er).To(MatchError(ErrInvalidScope))
+	})
+
+	It("Should only accept the key with its secret", func() {
+		k, key, er := keys.Create(a, "bot", []string{ScopeRead})
+		Expect(er).To(BeNil())
+		Expect(key).To(HavePrefix(k.Id + "."))
+
+		checked, er := keys.Check(key)
+		Expect(er).To(BeNil())
+		Expect(checked).To(Equal(k))
+
+		_, er = keys.Check(k.Id + ".0000")
+		Expect(er).To(Equal(ErrInvalidApiKey))
+		_, er = keys.Check(k.Id)
+		Expect(er).To(Equal(ErrInvalidApiKey))
+		_, er = keys.Check(strings.Repeat("0", len(key)))
+		Expect(er).To(Equal(ErrInvalidApiKey))
+	})
+
+	It("Should unlock the address with a post key", func() {
+		_, key, er := keys.Create(a, "bot", []string{ScopePost})
+		Expect(er).To(BeNil())
+
+		_, unlocked, er := keys.Unlock(key)
+		Expect(er).To(BeNil())
+		Expect(unlocked.Address).To(Equal(a.Address))
+		Expect(unlocked.Keys.PrivateKey).To(Equal(a.Keys.PrivateKey))
+	})
+
+	It("Should not unlock the address with a key without the post scope", func() {
+		_, key, er := keys.Create(a, "bot", []string{ScopeRead})
+		Expect(er).To(BeNil())
+		_, _, er = keys.Unlock(key)
+		Expect(er).To(MatchError(ErrInvalidScope))
+	})
+
+	It("Should need the private key to create a post key", func() {
+		_, _, er := keys.Create(&address.Address{Address: a.Address}, "bot", []string{ScopePost})
+		Expect(er).To(Equal(ErrLocked))
+	})
+
+	It("Should not revoke the key of another address", func() {
+		k, key, er := keys.Create(a, "bot", []string{ScopeRead})
+		Expect(er).To(BeNil())
+		Expect(keys.Revoke("other", k.Id)).To(Equal(ErrApiKeyNotFound))
+		_, er = keys.Check(key)
+		Expect(er).To(BeNil())
+
+		Expect(keys.Revoke(a.Address, k.Id)).To(Succeed())
+		_, er = keys.Check(key)
+		Expect(er).To(Equal(ErrInvalidApiKey))
+		Expect(keys.Revoke(a.Address, k.Id)).To(Equal(ErrApiKeyNotFound))
+	})
+
+	It("Should revoke all the keys of an address only", func() {
+		other, er := address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+		for i := 0; i < 2; i++ {
+			_, _, er = keys.Create(a, "bot", []string{ScopeRead})
+			Expect(er).To(BeNil())
+		}
+		_, otherKey, er := keys.Create(other, "bot", []string{ScopeRead})
+		Expect(er).To(BeNil())
+
+		Expect(keys.RevokeAll(a.Address)).To(Succeed())
+		list, er := keys.List(a.Address)
+		Expect(er).To(BeNil())
+		Expect(list).To(BeEmpty())
+		_, er = keys.Check(otherKey)
+		Expect(er).To(BeNil())
+	})
+})
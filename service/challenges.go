@@ -0,0 +1,113 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/msaldanha/setinstone/address"
+
+	"github.com/msaldanha/pulpit/models"
+)
+
+const (
+	challengeTTL       = 2 * time.Minute
+	challengeNonceSize = 32
+	challengePrefix    = "pulpit login"
+)
+
+// Challenges keeps the login challenges issued and not answered yet. Each one can be answered only once, before it
+// expires.
+type Challenges struct {
+	mtx     sync.Mutex
+	ttl     time.Duration
+	pending map[string]models.Challenge
+}
+
+func NewChallenges(ttl time.Duration) *Challenges {
+	return &Challenges{
+		ttl:     ttl,
+		pending: map[string]models.Challenge{},
+	}
+}
+
+// New issues a challenge for addr. The client proves it holds the key of addr by signing its message.
+func (c *Challenges) New(addr string, now time.Time) (models.Challenge, error) {
+	if addr == "" {
+		return models.Challenge{}, fmt.Errorf("address cannot be empty")
+	}
+	b := make([]byte, challengeNonceSize)
+	if _, er := rand.Read(b); er != nil {
+		return models.Challenge{}, er
+	}
+	nonce := hex.EncodeToString(b)
+	ch := models.Challenge{
+		Nonce:     nonce,
+		Message:   fmt.Sprintf("%s %s %s", challengePrefix, addr, nonce),
+		ExpiresAt: now.Add(c.ttl).Unix(),
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.purge(now)
+	c.pending[nonce] = ch
+	return ch, nil
+}
+
+// Verify consumes the challenge nonce and checks that signature (hex of an ASN.1 ECDSA signature of the SHA-256 of
+// the challenge message) was made by the key of addr, whose public key is publicKey (hex)
+func (c *Challenges) Verify(addr, publicKey, nonce, signature string, now time.Time) error {
+	c.mtx.Lock()
+	ch, found := c.pending[nonce]
+	delete(c.pending, nonce)
+	c.mtx.Unlock()
+
+	if !found || ch.ExpiresAt < now.Unix() || ch.Message != fmt.Sprintf("%s %s %s", challengePrefix, addr, nonce) {
+		return fmt.Errorf("%w: unknown or expired challenge", ErrInvalidSignature)
+	}
+
+	keys := address.Keys{PublicKey: publicKey}
+	pub, er := keys.ToEcdsaPublicKey()
+	if er != nil || pub == nil {
+		return fmt.Errorf("%w: invalid public key", ErrInvalidSignature)
+	}
+	a, er := address.NewAddressFromPublicKey(pub)
+	if er != nil || a.Address != addr {
+		return fmt.Errorf("%w: the public key does not belong to %s", ErrInvalidSignature, addr)
+	}
+	sig, er := hex.DecodeString(signature)
+	if er != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, er)
+	}
+	hash := sha256.Sum256([]byte(ch.Message))
+	if !ecdsa.VerifyASN1(pub, hash[:], sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignChallenge returns the signature of the message of ch with the private key of a, as expected by Verify
+func SignChallenge(a *address.Address, ch models.Challenge) (string, error) {
+	pk, er := a.Keys.ToEcdsaPrivateKey()
+	if er != nil {
+		return "", er
+	}
+	hash := sha256.Sum256([]byte(ch.Message))
+	sig, er := ecdsa.SignASN1(rand.Reader, pk, hash[:])
+	if er != nil {
+		return "", er
+	}
+	return hex.EncodeToString(sig), nil
+}
+
+func (c *Challenges) purge(now time.Time) {
+	for nonce, ch := range c.pending {
+		if ch.ExpiresAt < now.Unix() {
+			delete(c.pending, nonce)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"time"
+
+	"github.com/msaldanha/setinstone/address"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/pulpit/models"
+)
+
+var _ = Describe("Challenges", func() {
+	var challenges *Challenges
+	var a *address.Address
+	var now time.Time
+
+	BeforeEach(func() {
+		challenges = NewChallenges(time.Minute)
+		now = time.Unix(1700000000, 0)
+		var er error
+		a, er = address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+	})
+
+	newSigned := func(signer *address.Address) (models.Challenge, string) {
+		ch, er := challenges.New(a.Address, now)
+		Expect(er).To(BeNil())
+		sig, er := SignChallenge(signer, ch)
+		Expect(er).To(BeNil())
+		return ch, sig
+	}
+
+	It("Should verify a signed challenge", func() {
+		ch, sig := newSigned(a)
+		Expect(challenges.Verify(a.Address, a.Keys.PublicKey, ch.Nonce, sig, now)).To(Succeed())
+	})
+
+	It("Should not accept a challenge twice", func() {
+		ch, sig := newSigned(a)
+		Expect(challenges.Verify(a.Address, a.Keys.PublicKey, ch.Nonce, sig, now)).To(Succeed())
+		Expect(challenges.Verify(a.Address, a.Keys.PublicKey, ch.Nonce, sig, now)).To(MatchError(ErrInvalidSignature))
+	})
+
+	It("Should not accept an expired challenge", func() {
+		ch, sig := newSigned(a)
+		later := now.Add(time.Minute + time.Second)
+		Expect(challenges.Verify(a.Address, a.Keys.PublicKey, ch.Nonce, sig, later)).To(MatchError(ErrInvalidSignature))
+	})
+
+	It("Should not accept a public key of another address", func() {
+		other, er := address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+		ch, sig := newSigned(other)
+		Expect(challenges.Verify(a.Address, other.Keys.PublicKey, ch.Nonce, sig, now)).To(MatchError(ErrInvalidSignature))
+	})
+
+	It("Should not accept a signature of another key", func() {
+		other, er := address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+		ch, sig := newSigned(other)
+		Expect(challenges.Verify(a.Address, a.Keys.PublicKey, ch.Nonce, sig, now)).To(Equal(ErrInvalidSignature))
+	})
+
+	It("Should not accept a challenge issued for another address", func() {
+		other, er := address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+		ch, sig := newSigned(other)
+		Expect(challenges.Verify(other.Address, other.Keys.PublicKey, ch.Nonce, sig, now)).To(MatchError(ErrInvalidSignature))
+	})
+})
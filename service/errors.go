@@ -0,0 +1,20 @@
+package service
+
+import "errors"
+
+var (
+	ErrAddressNotFound   = errors.New("addr not found in local storage")
+	ErrNotLoggedIn       = errors.New("addr is not logged in")
+	ErrInvalidPassword   = errors.New("invalid addr or password")
+	ErrLocked            = errors.New("addr is locked, it must be unlocked with its password")
+	ErrAddressExists     = errors.New("addr already exists in local storage")
+	ErrInvalidKeystore   = errors.New("invalid keystore")
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+	ErrInvalidMnemonic   = errors.New("invalid mnemonic")
+	ErrTooManyAttempts   = errors.New("too many failed attempts for addr")
+	ErrInvalidApiKey     = errors.New("invalid api key")
+	ErrApiKeyNotFound    = errors.New("api key not found")
+	ErrInvalidScope      = errors.New("invalid api key scope")
+	ErrInvalidSignature  = errors.New("invalid challenge signature")
+	ErrAlreadyRevoked    = errors.New("token already revoked")
+)
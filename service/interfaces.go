@@ -10,4 +10,5 @@ type SubscriptionsStore interface {
 	GetAllSubscriptionsForOwner(address string) ([]models.Subscription, error)
 	GetAllSubscriptions() ([]models.Subscription, error)
 	GetOwners() ([]string, error)
+	Count() (int, error)
 }
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	kdfArgon2id = "argon2id"
+	kdfSaltSize = 16
+	kdfKeySize  = 32
+
+	// the default parameters (RFC 9106 second recommended option)
+	kdfTime    = 3
+	kdfMemory  = 64 * 1024 // in KiB
+	kdfThreads = 4
+)
+
+// KdfParams are the parameters used to derive an encryption key from a password. They are stored with the data
+// they protect, so they can be raised later without breaking the existing records.
+type KdfParams struct {
+	Algorithm string
+	Salt      []byte
+	Time      uint32
+	Memory    uint32 // in KiB
+	Threads   uint32
+}
+
+// newKdfParams returns the default parameters with a new random salt
+func newKdfParams() (KdfParams, error) {
+	salt := make([]byte, kdfSaltSize)
+	if _, er := rand.Read(salt); er != nil {
+		return KdfParams{}, er
+	}
+	return KdfParams{
+		Algorithm: kdfArgon2id,
+		Salt:      salt,
+		Time:      kdfTime,
+		Memory:    kdfMemory,
+		Threads:   kdfThreads,
+	}, nil
+}
+
+// deriveKey returns the AES-256 key of pass
+func (p KdfParams) deriveKey(pass string) ([]byte, error) {
+	switch p.Algorithm {
+	case kdfArgon2id:
+		if len(p.Salt) == 0 || p.Time == 0 || p.Memory == 0 || p.Threads == 0 || p.Threads > 255 {
+			return nil, fmt.Errorf("invalid %s parameters", p.Algorithm)
+		}
+		return argon2.IDKey([]byte(pass), p.Salt, p.Time, p.Memory, uint8(p.Threads), kdfKeySize), nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function %q", p.Algorithm)
+	}
+}
+
+// seal encrypts plaintext with AES-GCM, prefixing it with the random nonce
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, er := newGCM(key)
+	if er != nil {
+		return nil, er
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, er = rand.Read(nonce); er != nil {
+		return nil, er
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts what seal encrypted. It fails if key is wrong or sealed was tampered with.
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, er := newGCM(key)
+	if er != nil {
+		return nil, er
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("sealed data is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, er := aes.NewCipher(key)
+	if er != nil {
+		return nil, er
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/msaldanha/setinstone/address"
+)
+
+// Keyring holds the decrypted private keys of the unlocked addresses. A key is locked again when it is not used for
+// idleTimeout, or explicitly by Lock. Locking only clears the keyring copy: the addresses returned by Get carry their
+// own copy of the key, which lives as long as their holder (i.e. the writable timeline of the address).
+type Keyring struct {
+	mtx         sync.Mutex
+	keys        map[string]*unlockedKey
+	idleTimeout time.Duration
+	onIdleLock  func(addr string)
+}
+
+type unlockedKey struct {
+	addr     *address.Address
+	key      []byte
+	timer    *time.Timer
+	lastUsed time.Time
+}
+
+// NewKeyring returns an empty keyring. If idleTimeout is zero the keys stay unlocked until Lock is called.
+// onIdleLock, if not nil, is called (without the keyring lock held) after a key is locked for being idle.
+func NewKeyring(idleTimeout time.Duration, onIdleLock func(addr string)) *Keyring {
+	return &Keyring{
+		keys:        map[string]*unlockedKey{},
+		idleTimeout: idleTimeout,
+		onIdleLock:  onIdleLock,
+	}
+}
+
+// Unlock keeps the private key of a, replacing the previous one if the address was already unlocked
+func (k *Keyring) Unlock(a *address.Address) {
+	pub := a.Clone()
+	key := []byte(pub.Keys.PrivateKey)
+	pub.Keys.PrivateKey = ""
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.lock(a.Address)
+	u := &unlockedKey{addr: pub, key: key, lastUsed: time.Now()}
+	if k.idleTimeout > 0 {
+		u.timer = time.AfterFunc(k.idleTimeout, func() {
+			k.expire(a.Address, u)
+		})
+	}
+	k.keys[a.Address] = u
+}
+
+// Get returns addr with its private key, restarting the idle period. It returns ErrLocked if addr is not unlocked.
+func (k *Keyring) Get(addr string) (*address.Address, error) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	u, found := k.keys[addr]
+	if !found {
+		return nil, ErrLocked
+	}
+	u.lastUsed = time.Now()
+	if u.timer != nil {
+		u.timer.Reset(k.idleTimeout)
+	}
+	a := u.addr.Clone()
+	a.Keys.PrivateKey = string(u.key)
+	return a, nil
+}
+
+// IsUnlocked tells if addr is unlocked, without restarting the idle period
+func (k *Keyring) IsUnlocked(addr string) bool {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	_, found := k.keys[addr]
+	return found
+}
+
+// Lock forgets the private key of addr, so Get fails until it is unlocked again
+func (k *Keyring) Lock(addr string) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.lock(addr)
+}
+
+// Close locks all the keys
+func (k *Keyring) Close() {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	for addr := range k.keys {
+		k.lock(addr)
+	}
+}
+
+// Count returns the number of unlocked keys
+func (k *Keyring) Count() int {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	return len(k.keys)
+}
+
+func (k *Keyring) lock(addr string) {
+	u, found := k.keys[addr]
+	if !found {
+		return
+	}
+	if u.timer != nil {
+		u.timer.Stop()
+	}
+	for i := range u.key {
+		u.key[i] = 0
+	}
+	delete(k.keys, addr)
+}
+
+func (k *Keyring) expire(addr string, u *unlockedKey) {
+	k.mtx.Lock()
+	// the key may have been locked, replaced or used meanwhile
+	if k.keys[addr] != u || time.Since(u.lastUsed) < k.idleTimeout {
+		k.mtx.Unlock()
+		return
+	}
+	k.lock(addr)
+	k.mtx.Unlock()
+
+	if k.onIdleLock != nil {
+		k.onIdleLock(addr)
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+)
+
+var _ = Describe("Keyring", func() {
+	var a *address.Address
+
+	BeforeEach(func() {
+		var er error
+		a, er = address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+	})
+
+	It("Should return the unlocked key until it is locked", func() {
+		keyring := NewKeyring(0, nil)
+		_, er := keyring.Get(a.Address)
+		Expect(er).To(MatchError(ErrLocked))
+
+		keyring.Unlock(a)
+		Expect(keyring.IsUnlocked(a.Address)).To(BeTrue())
+		unlocked, er := keyring.Get(a.Address)
+		Expect(er).To(BeNil())
+		Expect(unlocked.Keys.PrivateKey).To(Equal(a.Keys.PrivateKey))
+		Expect(keyring.Count()).To(Equal(1))
+
+		keyring.Lock(a.Address)
+		Expect(keyring.IsUnlocked(a.Address)).To(BeFalse())
+		_, er = keyring.Get(a.Address)
+		Expect(er).To(MatchError(ErrLocked))
+		Expect(unlocked.Keys.PrivateKey).To(Equal(a.Keys.PrivateKey))
+	})
+
+	It("Should lock a key not used for the idle timeout and tell onIdleLock", func() {
+		locked := make(chan string, 1)
+		keyring := NewKeyring(100*time.Millisecond, func(addr string) { locked <- addr })
+		keyring.Unlock(a)
+
+		for i := 0; i < 3; i++ {
+			time.Sleep(60 * time.Millisecond)
+			_, er := keyring.Get(a.Address)
+			Expect(er).To(BeNil())
+		}
+		Expect(locked).NotTo(Receive())
+
+		Eventually(locked).Should(Receive(Equal(a.Address)))
+		Expect(keyring.IsUnlocked(a.Address)).To(BeFalse())
+	})
+
+	It("Should not tell onIdleLock of the keys locked explicitly", func() {
+		locked := make(chan string, 1)
+		keyring := NewKeyring(50*time.Millisecond, func(addr string) { locked <- addr })
+		keyring.Unlock(a)
+		keyring.Close()
+		Expect(keyring.Count()).To(Equal(0))
+		Consistently(locked, 150*time.Millisecond).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/msaldanha/setinstone/address"
+
+	"github.com/msaldanha/pulpit/models"
+)
+
+// keystoreVersion is the version of the keystore format
+const keystoreVersion = 2
+
+// Export returns addr as a keystore protected by keystorePass. If keystorePass is empty, pass is used.
+func (a *Addresses) Export(addr, pass, keystorePass string) (*models.Keystore, error) {
+	unlocked, er := a.Unlock(addr, pass)
+	if errors.Is(er, ErrAddressNotFound) {
+		return nil, er
+	}
+	if er != nil {
+		return nil, ErrInvalidPassword
+	}
+	if keystorePass == "" {
+		keystorePass = pass
+	}
+	return exportKeystore(unlocked, keystorePass)
+}
+
+// exportKeystore returns the unlocked address as a keystore protected by keystorePass
+func exportKeystore(unlocked *address.Address, keystorePass string) (*models.Keystore, error) {
+	kdf, er := newKdfParams()
+	if er != nil {
+		return nil, er
+	}
+	key, er := kdf.deriveKey(keystorePass)
+	if er != nil {
+		return nil, er
+	}
+	privKey, er := seal(key, []byte(unlocked.Keys.PrivateKey))
+	if er != nil {
+		return nil, er
+	}
+	bookmark, er := seal(key, []byte(bookmarkFlag))
+	if er != nil {
+		return nil, er
+	}
+	return &models.Keystore{
+		Version:    keystoreVersion,
+		Address:    unlocked.Address,
+		PublicKey:  unlocked.Keys.PublicKey,
+		PrivateKey: hex.EncodeToString(privKey),
+		Bookmark:   hex.EncodeToString(bookmark),
+		Kdf: &models.KeystoreKdf{
+			Algorithm: kdf.Algorithm,
+			Salt:      hex.EncodeToString(kdf.Salt),
+			Time:      kdf.Time,
+			Memory:    kdf.Memory,
+			Threads:   kdf.Threads,
+		},
+	}, nil
+}
+
+// Import stores the address of ks with its private key encrypted with pass. If pass is empty, keystorePass is used.
+func (a *Addresses) Import(ks *models.Keystore, keystorePass, pass string) (*address.Address, error) {
+	key, er := keystoreKey(ks, keystorePass)
+	if er != nil {
+		return nil, er
+	}
+	bookmark, er := hex.DecodeString(ks.Bookmark)
+	if er != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, er)
+	}
+	bookmark, er = open(key, bookmark)
+	if er != nil || string(bookmark) != bookmarkFlag {
+		return nil, ErrInvalidPassword
+	}
+	privKey, er := hex.DecodeString(ks.PrivateKey)
+	if er != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, er)
+	}
+	privKey, er = open(key, privKey)
+	if er != nil {
+		return nil, ErrInvalidPassword
+	}
+
+	imported, er := addressFromPrivateKey(string(privKey))
+	if er != nil {
+		return nil, er
+	}
+	if imported.Address != ks.Address {
+		return nil, fmt.Errorf("%w: the private key does not belong to %s", ErrInvalidKeystore, ks.Address)
+	}
+
+	if pass == "" {
+		pass = keystorePass
+	}
+	return imported, a.add(imported, pass)
+}
+
+// ImportPrivateKey stores the address of the (unencrypted) private key with it encrypted with pass
+func (a *Addresses) ImportPrivateKey(privateKey, pass string) (*address.Address, error) {
+	if pass == "" {
+		return nil, fmt.Errorf("password cannot be empty")
+	}
+	imported, er := addressFromPrivateKey(privateKey)
+	if er != nil {
+		return nil, er
+	}
+	return imported, a.add(imported, pass)
+}
+
+// add stores addr, failing if it is already stored
+func (a *Addresses) add(addr *address.Address, pass string) error {
+	_, found, er := a.store.Get(addr.Address)
+	if er != nil {
+		return er
+	}
+	if found {
+		return ErrAddressExists
+	}
+	return a.put(addr, pass)
+}
+
+// keystoreKey returns the key of ks derived from keystorePass. A keystore comes from outside, so its kdf parameters
+// can not ask for more than the defaults, which this version writes.
+func keystoreKey(ks *models.Keystore, keystorePass string) ([]byte, error) {
+	if ks == nil || ks.Version != keystoreVersion {
+		return nil, fmt.Errorf("%w: unsupported version", ErrInvalidKeystore)
+	}
+	if ks.Kdf == nil {
+		return nil, fmt.Errorf("%w: missing kdf", ErrInvalidKeystore)
+	}
+	if ks.Kdf.Time > kdfTime || ks.Kdf.Memory > kdfMemory || ks.Kdf.Threads > kdfThreads {
+		return nil, fmt.Errorf("%w: kdf parameters too high", ErrInvalidKeystore)
+	}
+	salt, er := hex.DecodeString(ks.Kdf.Salt)
+	if er != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, er)
+	}
+	kdf := KdfParams{
+		Algorithm: ks.Kdf.Algorithm,
+		Salt:      salt,
+		Time:      ks.Kdf.Time,
+		Memory:    ks.Kdf.Memory,
+		Threads:   ks.Kdf.Threads,
+	}
+	key, er := kdf.deriveKey(keystorePass)
+	if er != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, er)
+	}
+	return key, nil
+}
+
+func addressFromPrivateKey(privateKey string) (*address.Address, error) {
+	keys := address.Keys{PrivateKey: privateKey}
+	pk, er := keys.ToEcdsaPrivateKey()
+	if er != nil || pk == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	return address.NewAddressFromPrivateKey(pk)
+}
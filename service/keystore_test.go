@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/hex"
+
+	"github.com/msaldanha/setinstone/address"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/pulpit/models"
+)
+
+var _ = Describe("Keystore", func() {
+	const pass = "pass"
+	const keystorePass = "keystore pass"
+	var from, to *Addresses
+	var a *address.Address
+	var ks *models.Keystore
+	tb := withTempBolt()
+
+	BeforeEach(func() {
+		from = NewAddresses(NewBoltKeyValueStore(tb.db, "from"))
+		to = NewAddresses(NewBoltKeyValueStore(tb.db, "to"))
+		var er error
+		a, er = from.Create(pass)
+		Expect(er).To(BeNil())
+		ks, er = from.Export(a.Address, pass, keystorePass)
+		Expect(er).To(BeNil())
+	})
+
+	tamper := func(s string) string {
+		b, er := hex.DecodeString(s)
+		Expect(er).To(BeNil())
+		b[len(b)-1] ^= 1
+		return hex.EncodeToString(b)
+	}
+
+	It("Should import an exported address", func() {
+		Expect(ks.Version).To(Equal(keystoreVersion))
+		Expect(ks.PrivateKey).NotTo(ContainSubstring(a.Keys.PrivateKey))
+
+		imported, er := to.Import(ks, keystorePass, "new pass")
+		Expect(er).To(BeNil())
+		Expect(imported.Address).To(Equal(a.Address))
+		unlocked, er := to.Unlock(a.Address, "new pass")
+		Expect(er).To(BeNil())
+		Expect(unlocked.Keys.PrivateKey).To(Equal(a.Keys.PrivateKey))
+	})
+
+	It("Should not export with a wrong password", func() {
+		_, er := from.Export(a.Address, "wrong", keystorePass)
+		Expect(er).To(Equal(ErrInvalidPassword))
+	})
+
+	It("Should not import with a wrong keystore password", func() {
+		_, er := to.Import(ks, "wrong", pass)
+		Expect(er).To(Equal(ErrInvalidPassword))
+	})
+
+	It("Should not import a tampered keystore", func() {
+		tampered := *ks
+		tampered.PrivateKey = tamper(ks.PrivateKey)
+		_, er := to.Import(&tampered, keystorePass, pass)
+		Expect(er).To(Equal(ErrInvalidPassword))
+
+		tampered = *ks
+		tampered.Bookmark = tamper(ks.Bookmark)
+		_, er = to.Import(&tampered, keystorePass, pass)
+		Expect(er).To(Equal(ErrInvalidPassword))
+	})
+
+	It("Should not import the key of another address", func() {
+		other, er := address.NewAddressWithKeys()
+		Expect(er).To(BeNil())
+		tampered := *ks
+		tampered.Address = other.Address
+		_, er = to.Import(&tampered, keystorePass, pass)
+		Expect(er).To(MatchError(ErrInvalidKeystore))
+	})
+
+	It("Should not import an address twice", func() {
+		_, er := from.Import(ks, keystorePass, pass)
+		Expect(er).To(Equal(ErrAddressExists))
+	})
+
+	It("Should refuse other versions and kdf parameters above the defaults", func() {
+		tampered := *ks
+		tampered.Version = 1
+		_, er := to.Import(&tampered, keystorePass, pass)
+		Expect(er).To(MatchError(ErrInvalidKeystore))
+
+		for _, raise := range []func(kdf *models.KeystoreKdf){
+			func(kdf *models.KeystoreKdf) { kdf.Time++ },
+			func(kdf *models.KeystoreKdf) { kdf.Memory *= 2 },
+			func(kdf *models.KeystoreKdf) { kdf.Threads = 255 },
+		} {
+			kdf := *ks.Kdf
+			raise(&kdf)
+			tampered = *ks
+			tampered.Kdf = &kdf
+			_, er = to.Import(&tampered, keystorePass, pass)
+			Expect(er).To(MatchError(ErrInvalidKeystore))
+		}
+	})
+})
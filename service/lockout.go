@@ -0,0 +1,106 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LoginLockout counts the consecutive failed password checks of each address. After attempts failures the address
+// is locked out for lockout, doubled on every further failure up to maxLockout. The counters are kept in a store so
+// that they survive restarts.
+type LoginLockout struct {
+	mtx        sync.Mutex
+	store      KeyValueStore
+	attempts   int
+	lockout    time.Duration
+	maxLockout time.Duration
+}
+
+type failedLogins struct {
+	Failures    int   `json:"failures"`
+	LockedUntil int64 `json:"lockedUntil,omitempty"`
+}
+
+// NewLoginLockout returns a LoginLockout keeping its counters in store. If attempts is zero nothing is locked out.
+func NewLoginLockout(store KeyValueStore, attempts int, lockout, maxLockout time.Duration) *LoginLockout {
+	return &LoginLockout{
+		store:      store,
+		attempts:   attempts,
+		lockout:    lockout,
+		maxLockout: maxLockout,
+	}
+}
+
+// Attempt records a password check of addr at now. It is counted as failed until Succeeded clears it, so that parallel
+// guesses are all counted before any of them is checked. If addr is locked out at now, nothing is recorded and an
+// error wrapping ErrTooManyAttempts is returned.
+func (l *LoginLockout) Attempt(addr string, now time.Time) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	f, er := l.get(addr)
+	if er != nil {
+		return er
+	}
+	if f.LockedUntil > now.Unix() {
+		return fmt.Errorf("%w: try again after %s", ErrTooManyAttempts, time.Unix(f.LockedUntil, 0).UTC().Format(time.RFC3339))
+	}
+	f.Failures++
+	if l.attempts > 0 && f.Failures >= l.attempts {
+		f.LockedUntil = now.Add(l.lockoutFor(f.Failures - l.attempts)).Unix()
+	}
+	return l.put(addr, f)
+}
+
+// Failures returns the consecutive failures of addr and until when it is locked out (zero if it is not)
+func (l *LoginLockout) Failures(addr string) (int, time.Time, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	f, er := l.get(addr)
+	if er != nil || f.LockedUntil == 0 {
+		return f.Failures, time.Time{}, er
+	}
+	return f.Failures, time.Unix(f.LockedUntil, 0), nil
+}
+
+// Succeeded clears the failures of addr
+func (l *LoginLockout) Succeeded(addr string) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	_, found, er := l.store.Get(addr)
+	if er != nil || !found {
+		return er
+	}
+	return l.store.Delete(addr)
+}
+
+// lockoutFor returns the lockout after the n-th failure past the allowed attempts
+func (l *LoginLockout) lockoutFor(n int) time.Duration {
+	d := l.lockout
+	for i := 0; i < n && d < l.maxLockout; i++ {
+		d *= 2
+	}
+	if l.maxLockout > 0 && d > l.maxLockout {
+		d = l.maxLockout
+	}
+	return d
+}
+
+func (l *LoginLockout) get(addr string) (failedLogins, error) {
+	f := failedLogins{}
+	b, found, er := l.store.Get(addr)
+	if er != nil || !found {
+		return f, er
+	}
+	er = json.Unmarshal(b, &f)
+	return f, er
+}
+
+func (l *LoginLockout) put(addr string, f failedLogins) error {
+	b, er := json.Marshal(f)
+	if er != nil {
+		return er
+	}
+	return l.store.Put(addr, b)
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoginLockout", func() {
+	const addr = "addr"
+	var lockout *LoginLockout
+	var now time.Time
+	tb := withTempBolt()
+
+	newLockout := func(attempts int, lockout, maxLockout time.Duration) *LoginLockout {
+		return NewLoginLockout(NewBoltKeyValueStore(tb.db, "lockout"), attempts, lockout, maxLockout)
+	}
+
+	BeforeEach(func() {
+		now = time.Unix(1700000000, 0)
+		lockout = newLockout(3, time.Minute, 4*time.Minute)
+	})
+
+	failures := func(n int) {
+		for i := 0; i < n; i++ {
+			Expect(lockout.Attempt(addr, now)).To(Succeed())
+		}
+	}
+
+	lockedFor := func() time.Duration {
+		_, lockedUntil, er := lockout.Failures(addr)
+		Expect(er).To(BeNil())
+		if lockedUntil.IsZero() {
+			return 0
+		}
+		return lockedUntil.Sub(now)
+	}
+
+	It("Should lock out after the allowed attempts", func() {
+		failures(2)
+		Expect(lockedFor()).To(BeZero())
+		Expect(lockout.Attempt(addr, now)).To(Succeed())
+		Expect(lockedFor()).To(Equal(time.Minute))
+
+		Expect(lockout.Attempt(addr, now)).To(MatchError(ErrTooManyAttempts))
+		Expect(lockout.Attempt(addr, now.Add(59*time.Second))).To(MatchError(ErrTooManyAttempts))
+		Expect(lockout.Attempt(addr, now.Add(time.Minute))).To(Succeed())
+	})
+
+	It("Should not count the attempts refused while locked out", func() {
+		failures(3)
+		Expect(lockout.Attempt(addr, now)).To(MatchError(ErrTooManyAttempts))
+		n, _, er := lockout.Failures(addr)
+		Expect(er).To(BeNil())
+		Expect(n).To(Equal(3))
+	})
+
+	It("Should double the lockout on every further failure up to the maximum", func() {
+		expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute}
+		failures(2)
+		for _, d := range expected {
+			Expect(lockout.Attempt(addr, now)).To(Succeed())
+			Expect(lockedFor()).To(Equal(d))
+			now = now.Add(d)
+		}
+	})
+
+	It("Should clear the failures on success", func() {
+		failures(3)
+		Expect(lockout.Succeeded(addr)).To(Succeed())
+		n, lockedUntil, er := lockout.Failures(addr)
+		Expect(er).To(BeNil())
+		Expect(n).To(BeZero())
+		Expect(lockedUntil.IsZero()).To(BeTrue())
+		Expect(lockout.Attempt(addr, now)).To(Succeed())
+	})
+
+	It("Should keep the failures when the store is reopened", func() {
+		failures(3)
+		tb.reopen()
+		lockout = newLockout(3, time.Minute, 4*time.Minute)
+		n, _, er := lockout.Failures(addr)
+		Expect(er).To(BeNil())
+		Expect(n).To(Equal(3))
+		Expect(lockout.Attempt(addr, now)).To(MatchError(ErrTooManyAttempts))
+	})
+
+	It("Should never lock out when the attempts are zero", func() {
+		lockout = newLockout(0, time.Minute, time.Hour)
+		failures(10)
+		Expect(lockedFor()).To(BeZero())
+	})
+})
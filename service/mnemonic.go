@@ -0,0 +1,111 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+
+	"github.com/msaldanha/setinstone/address"
+)
+
+const (
+	// 128 bits of entropy give a 12 words mnemonic
+	mnemonicEntropyBits = 128
+	mnemonicKeySalt     = "pulpit address key"
+)
+
+// keyCurve is the curve of the address keys, so that the derived keys are always compatible with the ones created by
+// address.NewAddressWithKeys. The package fails to initialize if it cannot be told.
+var keyCurve = addressKeyCurve()
+
+// CreateWithMnemonic generates a new address from a new mnemonic and stores it with its private key encrypted with
+// pass. The mnemonic is returned so that the address can be recovered later with Recover.
+func (a *Addresses) CreateWithMnemonic(pass string) (*address.Address, string, error) {
+	if pass == "" {
+		return nil, "", fmt.Errorf("password cannot be empty")
+	}
+
+	entropy, er := bip39.NewEntropy(mnemonicEntropyBits)
+	if er != nil {
+		return nil, "", er
+	}
+	mnemonic, er := bip39.NewMnemonic(entropy)
+	if er != nil {
+		return nil, "", er
+	}
+
+	addr, er := addressFromMnemonic(mnemonic)
+	if er != nil {
+		return nil, "", er
+	}
+
+	er = a.add(addr, pass)
+	if er != nil {
+		return nil, "", er
+	}
+
+	return addr, mnemonic, nil
+}
+
+// Recover rebuilds the address of mnemonic and stores it with its private key encrypted with pass, replacing the
+// stored one (and so its password) if it exists.
+func (a *Addresses) Recover(mnemonic, pass string) (*address.Address, error) {
+	if pass == "" {
+		return nil, fmt.Errorf("password cannot be empty")
+	}
+
+	addr, er := addressFromMnemonic(mnemonic)
+	if er != nil {
+		return nil, er
+	}
+
+	er = a.put(addr, pass)
+	if er != nil {
+		return nil, er
+	}
+
+	return addr, nil
+}
+
+// addressFromMnemonic derives deterministically the key pair of an address from the BIP39 seed of mnemonic
+func addressFromMnemonic(mnemonic string) (*address.Address, error) {
+	mnemonic = strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	seed, er := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if er != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMnemonic, er)
+	}
+
+	c := keyCurve
+
+	// the private key is the seed HMAC taken modulo N-1, plus 1, so that it is in [1, N-1]
+	mac := hmac.New(sha512.New, []byte(mnemonicKeySalt))
+	mac.Write(seed)
+	n1 := new(big.Int).Sub(c.Params().N, big.NewInt(1))
+	d := new(big.Int).SetBytes(mac.Sum(nil))
+	d.Mod(d, n1)
+	d.Add(d, big.NewInt(1))
+
+	pk := &ecdsa.PrivateKey{D: d}
+	pk.PublicKey.Curve = c
+	pk.PublicKey.X, pk.PublicKey.Y = c.ScalarBaseMult(d.FillBytes(make([]byte, (c.Params().BitSize+7)/8)))
+
+	return address.NewAddressFromPrivateKey(pk)
+}
+
+// addressKeyCurve returns the curve address.Keys decodes the private keys on, taken from the fixed key 1. It panics
+// if the key cannot be decoded, as no address could be derived then.
+func addressKeyCurve() elliptic.Curve {
+	keys := address.Keys{PrivateKey: hex.EncodeToString(big.NewInt(1).FillBytes(make([]byte, 32)))}
+	pk, er := keys.ToEcdsaPrivateKey()
+	if er != nil || pk == nil || pk.Curve == nil {
+		panic(fmt.Sprintf("cannot tell the curve of the address keys: %v", er))
+	}
+	return pk.Curve
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mnemonic", func() {
+	const pass = "pass"
+	var addresses *Addresses
+	tb := withTempBolt()
+
+	BeforeEach(func() {
+		addresses = NewAddresses(NewBoltKeyValueStore(tb.db, "addresses"))
+	})
+
+	It("Should recover the address created with a mnemonic", func() {
+		created, mnemonic, er := addresses.CreateWithMnemonic(pass)
+		Expect(er).To(BeNil())
+		Expect(strings.Fields(mnemonic)).To(HaveLen(12))
+
+		other := NewAddresses(NewBoltKeyValueStore(tb.db, "other"))
+		recovered, er := other.Recover("  "+strings.ToUpper(mnemonic)+" ", "new pass")
+		Expect(er).To(BeNil())
+		Expect(recovered.Address).To(Equal(created.Address))
+		Expect(recovered.Keys.PrivateKey).To(Equal(created.Keys.PrivateKey))
+
+		unlocked, er := other.Unlock(created.Address, "new pass")
+		Expect(er).To(BeNil())
+		Expect(unlocked.Keys.PublicKey).To(Equal(created.Keys.PublicKey))
+	})
+
+	It("Should replace the password of a recovered address", func() {
+		created, mnemonic, er := addresses.CreateWithMnemonic(pass)
+		Expect(er).To(BeNil())
+		_, er = addresses.Recover(mnemonic, "new pass")
+		Expect(er).To(BeNil())
+		_, er = addresses.Unlock(created.Address, pass)
+		Expect(er).To(Equal(ErrInvalidPassword))
+		_, er = addresses.Unlock(created.Address, "new pass")
+		Expect(er).To(BeNil())
+	})
+
+	It("Should refuse a mnemonic with an invalid checksum", func() {
+		// the zero entropy, whose last word is "about" with its checksum
+		valid := strings.Repeat("abandon ", 11) + "about"
+		_, er := addresses.Recover(valid, pass)
+		Expect(er).To(BeNil())
+
+		_, er = addresses.Recover(strings.Repeat("abandon ", 11)+"abandon", pass)
+		Expect(er).To(MatchError(ErrInvalidMnemonic))
+	})
+})
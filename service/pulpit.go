@@ -2,13 +2,14 @@ package service
 
 import (
 	"context"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	files "github.com/ipfs/boxo/files"
 	"github.com/ipfs/boxo/path"
@@ -19,22 +20,28 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/msaldanha/setinstone/address"
-	"github.com/msaldanha/setinstone/crypto"
 	"github.com/msaldanha/setinstone/event"
 	"github.com/msaldanha/setinstone/graph"
 	"github.com/msaldanha/timeline"
 
+	"github.com/msaldanha/pulpit/metrics"
 	"github.com/msaldanha/pulpit/models"
 )
 
 const addressValue = "address"
 
 type PulpitService struct {
-	store              KeyValueStore
+	mtx                sync.Mutex
+	addresses          *Addresses
 	timelines          map[string]*timeline.Timeline
+	apiKeyring         *Keyring
 	ipfs               icore.CoreAPI
 	node               *core.IpfsNode
-	logins             map[string]string
+	keyring            *Keyring
+	lockout            *LoginLockout
+	apiKeys            *ApiKeys
+	challenges         *Challenges
+	sessions           map[string]int
 	evmFactory         event.ManagerFactory
 	logger             *zap.Logger
 	subsStore          SubscriptionsStore
@@ -44,99 +51,285 @@ type PulpitService struct {
 }
 
 func NewPulpitService(nameSpace string, store KeyValueStore, ipfs icore.CoreAPI, node *core.IpfsNode, evmFactory event.ManagerFactory,
-	logger *zap.Logger, subsStore SubscriptionsStore, db *bolt.DB) *PulpitService {
-	return &PulpitService{
-		store:              store,
+	logger *zap.Logger, subsStore SubscriptionsStore, db *bolt.DB, keyIdleTimeout time.Duration, lockout *LoginLockout,
+	apiKeys *ApiKeys) *PulpitService {
+	s := &PulpitService{
+		addresses:          NewAddresses(store),
 		ipfs:               ipfs,
 		node:               node,
 		timelines:          map[string]*timeline.Timeline{},
-		logins:             map[string]string{},
+		sessions:           map[string]int{},
 		evmFactory:         evmFactory,
 		logger:             logger.Named("Pulpit"),
 		subsStore:          subsStore,
 		compositeTimelines: map[string]*timeline.CompositeTimeline{},
 		nameSpace:          nameSpace,
 		db:                 db,
+		lockout:            lockout,
+		apiKeys:            apiKeys,
+		challenges:         NewChallenges(challengeTTL),
 	}
+	s.keyring = NewKeyring(keyIdleTimeout, s.keyLocked)
+	s.apiKeyring = NewKeyring(keyIdleTimeout, s.apiKeyLocked)
+	return s
 }
 
 func (s *PulpitService) CreateAddress(ctx context.Context, pass string) (string, error) {
-	if pass == "" {
-		return "", fmt.Errorf("password cannot be empty")
+	a, er := s.addresses.Create(pass)
+	if er != nil {
+		return "", er
 	}
 
-	a, er := address.NewAddressWithKeys()
+	return a.Address, nil
+}
+
+// CreateAddressWithMnemonic creates an address derived from a new mnemonic, returning both
+func (s *PulpitService) CreateAddressWithMnemonic(ctx context.Context, pass string) (string, string, error) {
+	a, mnemonic, er := s.addresses.CreateWithMnemonic(pass)
+	if er != nil {
+		return "", "", er
+	}
+
+	return a.Address, mnemonic, nil
+}
+
+// RecoverAddress rebuilds the address of mnemonic protected by pass. If the address was stored, its password is
+// replaced and all its sessions are ended.
+func (s *PulpitService) RecoverAddress(ctx context.Context, mnemonic, pass string) (string, error) {
+	a, er := s.addresses.Recover(mnemonic, pass)
 	if er != nil {
 		return "", er
 	}
 
-	dbAddress := a.Clone()
-	dbAddress.Keys.PrivateKey = hex.EncodeToString(crypto.Encrypt([]byte(dbAddress.Keys.PrivateKey), pass))
-	ar := AddressRecord{
-		Address:  *dbAddress,
-		Bookmark: crypto.Encrypt([]byte(bookmarkFlag), pass),
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.endSessions(a.Address)
+	return a.Address, nil
+}
+
+// ExportAddress returns addr as a keystore protected by keystorePass (or by pass if keystorePass is empty). pass is
+// checked as on login.
+func (s *PulpitService) ExportAddress(ctx context.Context, addr, pass, keystorePass string) (*models.Keystore, error) {
+	a, er := s.checkPassword(addr, pass)
+	if er != nil {
+		return nil, er
+	}
+	if keystorePass == "" {
+		keystorePass = pass
 	}
+	return exportKeystore(a, keystorePass)
+}
 
-	er = s.store.Put(dbAddress.Address, ar.ToBytes())
+// ImportAddress stores the address of a keystore, protected by pass (or by keystorePass if pass is empty)
+func (s *PulpitService) ImportAddress(ctx context.Context, ks *models.Keystore, keystorePass, pass string) (string, error) {
+	a, er := s.addresses.Import(ks, keystorePass, pass)
 	if er != nil {
 		return "", er
 	}
+	return a.Address, nil
+}
 
-	s.logins[a.Address] = pass
-
+// ImportPrivateKey stores the address of a raw private key, protected by pass
+func (s *PulpitService) ImportPrivateKey(ctx context.Context, privateKey, pass string) (string, error) {
+	a, er := s.addresses.ImportPrivateKey(privateKey, pass)
+	if er != nil {
+		return "", er
+	}
 	return a.Address, nil
 }
 
+// DeleteAddress deletes addr and its api keys, and ends all its sessions
 func (s *PulpitService) DeleteAddress(ctx context.Context, addr string) error {
-	_, found, er := s.store.Get(addr)
+	er := s.addresses.Delete(addr)
 	if er != nil {
 		return er
 	}
-	if !found {
-		return errors.New("addr not found in local storage")
+	er = s.apiKeys.RevokeAll(addr)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.endSessions(addr)
+	return er
+}
+
+// CreateApiKey generates an api key for addr. A key with ScopePost keeps the private key of addr (encrypted with
+// the api key), so addr must be unlocked.
+func (s *PulpitService) CreateApiKey(ctx context.Context, addr, name string, scopes []string) (models.ApiKey, string, error) {
+	if !(models.ApiKey{Scopes: scopes}).HasScope(ScopePost) {
+		return s.apiKeys.Create(&address.Address{Address: addr}, name, scopes)
+	}
+	a, er := s.keyring.Get(addr)
+	if er != nil {
+		return models.ApiKey{}, "", er
 	}
-	er = s.store.Delete(addr)
+	return s.apiKeys.Create(a, name, scopes)
+}
+
+func (s *PulpitService) ListApiKeys(ctx context.Context, addr string) ([]models.ApiKey, error) {
+	return s.apiKeys.List(addr)
+}
+
+// RevokeApiKey revokes the api key id of addr. The timeline unlocked by the api keys of addr, if any, is dropped.
+func (s *PulpitService) RevokeApiKey(ctx context.Context, addr, id string) error {
+	er := s.apiKeys.Revoke(addr, id)
 	if er != nil {
 		return er
 	}
+	s.dropApiKeyTimeline(addr)
 	return nil
 }
 
+// CheckApiKey returns the api key of key, ErrInvalidApiKey if there is none
+func (s *PulpitService) CheckApiKey(ctx context.Context, key string) (models.ApiKey, error) {
+	return s.apiKeys.Check(key)
+}
+
 func (s *PulpitService) Login(ctx context.Context, addr, password string) error {
-	if addr == "" {
-		return fmt.Errorf("address cannot be empty")
+	a, er := s.checkPassword(addr, password)
+	if er != nil {
+		metrics.Login(metrics.LoginFailure)
+		return er
 	}
+	metrics.Login(metrics.LoginSuccess)
 
-	if password == "" {
-		return fmt.Errorf("password cannot be empty")
+	// the records in an older format are rewritten now that the password is known
+	upgraded, er := s.addresses.Upgrade(a, password)
+	if er != nil {
+		s.logger.Warn("failed to upgrade address record", zap.String("addr", addr), zap.Error(er))
+	} else if upgraded {
+		s.logger.Info("address record upgraded", zap.String("addr", addr))
 	}
 
-	a, er := s.getAddress(addr, password)
-	if er != nil || !a.HasKeys() {
-		return errors.New("invalid addr or password")
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// the timelines are shared by all the sessions of the address. The session is only counted, and the key
+	// unlocked, once they are all running.
+	compositeTimeline, found := s.compositeTimelines[addr]
+	if !found {
+		compositeTimeline, er = s.createCompositeTimeLine(a)
+		if er != nil {
+			return er
+		}
+	}
+	if er = s.unlock(a); er != nil {
+		if !found {
+			compositeTimeline.Stop()
+			delete(s.compositeTimelines, addr)
+		}
+		return er
 	}
 
-	s.logins[addr] = password
+	s.sessions[addr]++
+	return nil
+}
 
-	tl, err := s.createTimeLine(a)
-	if err != nil {
-		return err
+// NewChallenge issues a challenge to login as addr with LoginWithSignature
+func (s *PulpitService) NewChallenge(ctx context.Context, addr string) (models.Challenge, error) {
+	return s.challenges.New(addr, time.Now())
+}
+
+// LoginWithSignature logs addr in if signature is the signature of the challenge nonce by its key. The key stays
+// with the client, so addr does not need to be local and its session is read only: it can read its subscriptions
+// and their feed, but writing fails with ErrLocked. Only a local address has a feed: the subscriptions are added
+// with a password session, so no composite timeline is loaded for an address that only proved it holds its key.
+func (s *PulpitService) LoginWithSignature(ctx context.Context, addr, publicKey, nonce, signature string) error {
+	er := s.challenges.Verify(addr, publicKey, nonce, signature, time.Now())
+	if er != nil {
+		metrics.Login(metrics.LoginFailure)
+		return er
 	}
-	compositeTimeline, err := s.createCompositeTimeLine(a)
-	if err != nil {
-		return err
+	metrics.Login(metrics.LoginSuccess)
+
+	_, local, er := s.addresses.Get(addr)
+	if er != nil {
+		return er
 	}
-	err = compositeTimeline.AddTimeline(tl)
-	if err != nil {
-		return err
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, found := s.compositeTimelines[addr]; !found && local {
+		a := &address.Address{Address: addr}
+		compositeTimeline, er := s.createCompositeTimeLine(a)
+		if er != nil {
+			return er
+		}
+		if er = compositeTimeline.LoadTimeline(a); er != nil {
+			compositeTimeline.Stop()
+			delete(s.compositeTimelines, addr)
+			return er
+		}
 	}
 
+	s.sessions[addr]++
+	return nil
+}
+
+// Unlock unlocks again the key of a logged in address, i.e. after it was locked for being idle
+func (s *PulpitService) Unlock(ctx context.Context, addr, password string) error {
+	if !s.IsLoggedIn(addr) {
+		return ErrNotLoggedIn
+	}
+
+	a, er := s.checkPassword(addr, password)
+	if er != nil {
+		return er
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.unlock(a)
+}
+
+// Lock locks the key of addr. The address stays logged in, but it cannot write until it is unlocked again.
+func (s *PulpitService) Lock(ctx context.Context, addr string) {
+	s.keyring.Lock(addr)
+	s.keyLocked(addr)
+}
+
+// Logout ends one session of addr. When no other session uses them, the address is logged out, its key is locked
+// and its timelines are stopped.
+func (s *PulpitService) Logout(ctx context.Context, addr string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.sessions[addr] == 0 {
+		return ErrNotLoggedIn
+	}
+
+	s.sessions[addr]--
+	if s.sessions[addr] > 0 {
+		return nil
+	}
+
+	s.endSessions(addr)
+	return nil
+}
+
+// ChangePassword re-encrypts the key of addr with newPass and ends all its sessions. oldPass is checked as on login.
+func (s *PulpitService) ChangePassword(ctx context.Context, addr, oldPass, newPass string) error {
+	if newPass == "" {
+		return fmt.Errorf("new password cannot be empty")
+	}
+	a, er := s.checkPassword(addr, oldPass)
+	if er != nil {
+		return er
+	}
+	if er = s.addresses.put(a, newPass); er != nil {
+		return er
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.endSessions(addr)
 	return nil
 }
 
 func (s *PulpitService) IsLoggedIn(addr string) bool {
-	_, found := s.logins[addr]
-	return found
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.sessions[addr] > 0
 }
 
 func (s *PulpitService) GetRandomAddress(ctx context.Context) (*address.Address, error) {
@@ -192,17 +385,7 @@ func (s *PulpitService) PostMedia(ctx context.Context, f []string) []models.AddM
 }
 
 func (s *PulpitService) GetAddresses(ctx context.Context) ([]*address.Address, error) {
-	all, er := s.store.GetAll()
-	if er != nil {
-		return nil, er
-	}
-	addresses := []*address.Address{}
-	for _, v := range all {
-		ar := AddressRecord{}
-		_ = ar.FromBytes(v)
-		addresses = append(addresses, &ar.Address)
-	}
-	return addresses, nil
+	return s.addresses.List()
 }
 
 func (s *PulpitService) GetItems(ctx context.Context, addr, keyRoot, connector, from, to string, count int) ([]timeline.Item, error) {
@@ -250,60 +433,58 @@ func (s *PulpitService) GetItemByKey(ctx context.Context, addr, key string) (*ti
 }
 
 func (s *PulpitService) CreateItem(ctx context.Context, addr, keyRoot, connector string, body models.AddItemRequest) (string, error) {
-	if connector == "" {
-		connector = "main"
+	tl, er := s.getWritableTimeline(addr)
+	if er != nil {
+		return "", er
 	}
 
-	tl, er := s.getTimeline(addr)
+	return s.createItem(ctx, tl, keyRoot, connector, body)
+}
+
+// CreateItemWithApiKey creates an item on the timeline of addr signed with the private key kept by the api key, so
+// addr does not need to be logged in
+func (s *PulpitService) CreateItemWithApiKey(ctx context.Context, apiKey, addr, keyRoot, connector string, body models.AddItemRequest) (string, error) {
+	k, a, er := s.apiKeys.Unlock(apiKey)
 	if er != nil {
 		return "", er
 	}
+	if k.Address != addr {
+		return "", ErrInvalidApiKey
+	}
 
-	key := ""
-	switch body.Type {
-	case timeline.TypePost:
-		key, er = s.createPost(ctx, tl, body.PostItem, keyRoot, connector)
-	case timeline.TypeReference:
-		key, er = s.createReference(ctx, tl, body.ReferenceItem, keyRoot, connector)
-	default:
-		er = fmt.Errorf("unknown type %s", body.Type)
+	tl, er := s.getApiKeyTimeline(a)
+	if er != nil {
 		return "", er
 	}
 
-	return key, er
+	return s.createItem(ctx, tl, keyRoot, connector, body)
 }
 
+// AddSubscription stores the subscription and loads it in the composite timeline of the owner if it is running. The
+// composite timeline only runs while the owner is logged in, which loads the stored subscriptions.
 func (s *PulpitService) AddSubscription(ctx context.Context, sub models.Subscription) error {
-	compositeTimeline, found := s.compositeTimelines[sub.Owner]
-	if !found {
-		var err error
-		dao := timeline.NewCompositeDao(s.db, sub.Owner)
-		compositeTimeline, err = timeline.NewCompositeTimeline(s.nameSpace, s.node, s.evmFactory, s.logger, sub.Owner, dao)
-		if err != nil {
-			return fmt.Errorf("unable to create composite timeline for owner %s %w", sub.Owner, err)
-		}
-		err = compositeTimeline.Init()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if compositeTimeline, found := s.compositeTimelines[sub.Owner]; found {
+		addr := &address.Address{Address: sub.Address}
+		err := compositeTimeline.LoadTimeline(addr)
 		if err != nil {
-			return fmt.Errorf("unable to init composite timeline for owner %s %w", sub.Owner, err)
+			return err
 		}
-		s.compositeTimelines[sub.Owner] = compositeTimeline
-	}
-	addr := &address.Address{Address: sub.Address}
-	err := compositeTimeline.LoadTimeline(addr)
-	if err != nil {
-		return err
 	}
 	return s.subsStore.AddSubscription(sub)
 }
 
+// RemoveSubscription removes the subscription from the store and from the composite timeline of the owner if it is
+// running
 func (s *PulpitService) RemoveSubscription(ctx context.Context, sub models.Subscription) error {
-	compositeTimeline, found := s.compositeTimelines[sub.Owner]
-	if !found {
-		return fmt.Errorf("no composite timeline for owner %s", sub.Owner)
-	}
-	err := compositeTimeline.RemoveTimeline(sub.Address)
-	if err != nil {
-		return err
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if compositeTimeline, found := s.compositeTimelines[sub.Owner]; found {
+		err := compositeTimeline.RemoveTimeline(sub.Address)
+		if err != nil {
+			return err
+		}
 	}
 	return s.subsStore.RemoveSubscription(sub)
 }
@@ -313,9 +494,9 @@ func (s *PulpitService) GetSubscriptions(ctx context.Context, owner string) ([]m
 }
 
 func (s *PulpitService) GetSubscriptionsPublications(ctx context.Context, owner, from string, count int) ([]timeline.Item, error) {
-	compositeTimeline, found := s.compositeTimelines[owner]
+	compositeTimeline, found := s.loadedCompositeTimeline(owner)
 	if !found {
-		return nil, fmt.Errorf("no composite timeline for owner %s", owner)
+		return nil, fmt.Errorf("%w: no composite timeline for owner %s", ErrNotLoggedIn, owner)
 	}
 	items, err := compositeTimeline.GetFrom(ctx, from, count)
 	if err != nil {
@@ -325,9 +506,9 @@ func (s *PulpitService) GetSubscriptionsPublications(ctx context.Context, owner,
 }
 
 func (s *PulpitService) ClearSubscriptionsPublications(ctx context.Context, owner string) error {
-	compositeTimeline, found := s.compositeTimelines[owner]
+	compositeTimeline, found := s.loadedCompositeTimeline(owner)
 	if !found {
-		return fmt.Errorf("no composite timeline for owner %s", owner)
+		return fmt.Errorf("%w: no composite timeline for owner %s", ErrNotLoggedIn, owner)
 	}
 	err := compositeTimeline.Clear()
 	if err != nil {
@@ -336,6 +517,144 @@ func (s *PulpitService) ClearSubscriptionsPublications(ctx context.Context, owne
 	return nil
 }
 
+// Stats tells how many timelines are active and how many subscriptions are stored
+type Stats struct {
+	Logins             int `json:"logins"`
+	UnlockedKeys       int `json:"unlockedKeys"`
+	Timelines          int `json:"timelines"`
+	CompositeTimelines int `json:"compositeTimelines"`
+	Subscriptions      int `json:"subscriptions"`
+}
+
+func (s *PulpitService) Stats() Stats {
+	subscriptions, er := s.subsStore.Count()
+	if er != nil {
+		s.logger.Warn("failed to count subscriptions", zap.Error(er))
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return Stats{
+		Logins:             len(s.sessions),
+		UnlockedKeys:       s.keyring.Count(),
+		Timelines:          len(s.timelines),
+		CompositeTimelines: len(s.compositeTimelines),
+		Subscriptions:      subscriptions,
+	}
+}
+
+// AccountStats tells the state of a local address
+type AccountStats struct {
+	Address       string     `json:"address"`
+	Sessions      int        `json:"sessions"`
+	Unlocked      bool       `json:"unlocked"`
+	Timeline      bool       `json:"timeline"`
+	Subscriptions int        `json:"subscriptions"`
+	FailedLogins  int        `json:"failedLogins"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty"`
+}
+
+// AccountStats returns the state of the local address addr
+func (s *PulpitService) AccountStats(ctx context.Context, addr string) (AccountStats, error) {
+	_, found, er := s.addresses.Get(addr)
+	if er != nil {
+		return AccountStats{}, er
+	}
+	if !found {
+		return AccountStats{}, ErrAddressNotFound
+	}
+	return s.accountStats(addr)
+}
+
+// AccountsStats returns the state of all the local addresses
+func (s *PulpitService) AccountsStats(ctx context.Context) ([]AccountStats, error) {
+	all, er := s.addresses.List()
+	if er != nil {
+		return nil, er
+	}
+	stats := []AccountStats{}
+	for _, a := range all {
+		st, er := s.accountStats(a.Address)
+		if er != nil {
+			return nil, er
+		}
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
+
+// ForceLogout ends all the sessions of addr, whatever their number
+func (s *PulpitService) ForceLogout(ctx context.Context, addr string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.sessions[addr] == 0 {
+		return ErrNotLoggedIn
+	}
+
+	s.endSessions(addr)
+	return nil
+}
+
+// Backup writes a consistent snapshot of the data store to a temporary file next to it and returns its path. The
+// read transaction only lasts while the file is written, so a slow reader of the snapshot does not keep it open. The
+// caller removes the file.
+func (s *PulpitService) Backup(ctx context.Context) (string, error) {
+	tmp, er := os.CreateTemp(filepath.Dir(s.db.Path()), filepath.Base(s.db.Path())+".backup-*")
+	if er != nil {
+		return "", er
+	}
+	_ = tmp.Close()
+	er = s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(tmp.Name(), 0600)
+	})
+	if er != nil {
+		_ = os.Remove(tmp.Name())
+		return "", er
+	}
+	return tmp.Name(), nil
+}
+
+// Close locks all the keys and stops all the running composite timelines
+func (s *PulpitService) Close() {
+	s.keyring.Close()
+	s.apiKeyring.Close()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for owner, compositeTimeline := range s.compositeTimelines {
+		compositeTimeline.Stop()
+		delete(s.compositeTimelines, owner)
+	}
+	for addr := range s.timelines {
+		delete(s.timelines, addr)
+	}
+	for addr := range s.sessions {
+		delete(s.sessions, addr)
+	}
+}
+
+func (s *PulpitService) createItem(ctx context.Context, tl *timeline.Timeline, keyRoot, connector string, body models.AddItemRequest) (string, error) {
+	if connector == "" {
+		connector = "main"
+	}
+
+	key := ""
+	var er error
+	switch body.Type {
+	case timeline.TypePost:
+		key, er = s.createPost(ctx, tl, body.PostItem, keyRoot, connector)
+	case timeline.TypeReference:
+		key, er = s.createReference(ctx, tl, body.ReferenceItem, keyRoot, connector)
+	default:
+		er = fmt.Errorf("unknown type %s", body.Type)
+		return "", er
+	}
+	if er == nil {
+		metrics.ItemCreated(body.Type)
+	}
+
+	return key, er
+}
+
 func (s *PulpitService) createPost(ctx context.Context, tl *timeline.Timeline, postItem models.PostItem, keyRoot, connector string) (string, error) {
 	if len(postItem.Connectors) == 0 {
 		er := fmt.Errorf("reference types cannot be empty")
@@ -374,20 +693,69 @@ func (s *PulpitService) createReference(ctx context.Context, tl *timeline.Timeli
 	return key, nil
 }
 
+// getTimeline returns the timeline of addr, creating a read only one if it is not loaded
 func (s *PulpitService) getTimeline(addr string) (*timeline.Timeline, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
 	tl, found := s.timelines[addr]
 	if found {
 		return tl, nil
 	}
+	return s.createTimeLine(&address.Address{Address: addr})
+}
 
-	pass := s.logins[addr]
+// getWritableTimeline returns the timeline of addr if its key is unlocked, ErrLocked otherwise
+func (s *PulpitService) getWritableTimeline(addr string) (*timeline.Timeline, error) {
+	a, er := s.keyring.Get(addr)
+	if er != nil {
+		return nil, er
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	// while the key is unlocked the loaded timeline is the writable one
+	tl, found := s.timelines[addr]
+	if found {
+		return tl, nil
+	}
+	return s.createTimeLine(a)
+}
 
-	a, er := s.getAddress(addr, pass)
+// getApiKeyTimeline returns the writable timeline of a for a post with an api key. All the posts of the address go
+// through the same timeline: the one of its sessions while its key is unlocked, otherwise one holding the key
+// decrypted by the api key. That key is kept in apiKeyring, so the timeline is dropped as the sessions ones when it
+// is idle, and also when an api key of the address is revoked or the address logs out.
+func (s *PulpitService) getApiKeyTimeline(a *address.Address) (*timeline.Timeline, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	tl, found := s.timelines[a.Address]
+	if found && s.keyring.IsUnlocked(a.Address) {
+		return tl, nil
+	}
+	if _, er := s.apiKeyring.Get(a.Address); found && er == nil {
+		return tl, nil
+	}
+	tl, er := s.createTimeLine(a)
 	if er != nil {
 		return nil, er
 	}
+	s.apiKeyring.Unlock(a)
+	return tl, nil
+}
 
-	return s.createTimeLine(a)
+// dropApiKeyTimeline locks the key of addr unlocked by an api key, dropping its timeline
+func (s *PulpitService) dropApiKeyTimeline(addr string) {
+	s.apiKeyring.Lock(addr)
+	s.apiKeyLocked(addr)
+}
+
+// apiKeyLocked drops the timeline of addr unlocked by an api key, unless the sessions of addr use it
+func (s *PulpitService) apiKeyLocked(addr string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.apiKeyring.IsUnlocked(addr) || s.keyring.IsUnlocked(addr) {
+		return
+	}
+	delete(s.timelines, addr)
 }
 
 func (s *PulpitService) getCompositeTimeline(ctx context.Context) (*timeline.CompositeTimeline, bool) {
@@ -395,39 +763,133 @@ func (s *PulpitService) getCompositeTimeline(ctx context.Context) (*timeline.Com
 	if addr == "" {
 		return nil, false
 	}
-	tl, found := s.compositeTimelines[addr]
+	return s.loadedCompositeTimeline(addr)
+}
+
+// loadedCompositeTimeline returns the composite timeline of owner if it is running
+func (s *PulpitService) loadedCompositeTimeline(owner string) (*timeline.CompositeTimeline, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	tl, found := s.compositeTimelines[owner]
 	return tl, found
 }
 
-func (s *PulpitService) getAddress(addr, pass string) (*address.Address, error) {
-	var a address.Address
-	a = address.Address{Address: addr}
-	if pass != "" {
-		buf, found, _ := s.store.Get(addr)
-		if found {
-			ar := AddressRecord{}
-			er := ar.FromBytes(buf)
-			if er != nil {
-				return nil, er
-			}
-			a = ar.Address
-			privKey, er := hex.DecodeString(ar.Address.Keys.PrivateKey)
-			if er != nil {
-				return nil, er
-			}
-			pk, er := crypto.Decrypt(privKey, pass)
-			if er != nil {
-				return nil, er
-			}
-			a.Keys.PrivateKey = string(pk)
+// endSessions logs addr out: its key is locked and its timelines are stopped. s.mtx must be held.
+func (s *PulpitService) endSessions(addr string) {
+	delete(s.sessions, addr)
+	s.keyring.Lock(addr)
+	s.apiKeyring.Lock(addr)
+	delete(s.timelines, addr)
+	if compositeTimeline, found := s.compositeTimelines[addr]; found {
+		compositeTimeline.Stop()
+		delete(s.compositeTimelines, addr)
+	}
+}
+
+func (s *PulpitService) accountStats(addr string) (AccountStats, error) {
+	subs, er := s.subsStore.GetAllSubscriptionsForOwner(addr)
+	if er != nil {
+		return AccountStats{}, er
+	}
+	st := AccountStats{
+		Address:       addr,
+		Unlocked:      s.keyring.IsUnlocked(addr),
+		Subscriptions: len(subs),
+	}
+	if s.lockout != nil {
+		failures, lockedUntil, er := s.lockout.Failures(addr)
+		if er != nil {
+			return AccountStats{}, er
+		}
+		st.FailedLogins = failures
+		if lockedUntil.After(time.Now()) {
+			st.LockedUntil = &lockedUntil
 		}
 	}
-	return &a, nil
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	st.Sessions = s.sessions[addr]
+	_, st.Timeline = s.compositeTimelines[addr]
+	return st, nil
+}
+
+// checkPassword returns addr with its private key decrypted if password is right
+func (s *PulpitService) checkPassword(addr, password string) (*address.Address, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("address cannot be empty")
+	}
+	if password == "" {
+		return nil, fmt.Errorf("password cannot be empty")
+	}
+	if s.lockout != nil {
+		// the failures of unknown addresses are not kept, so guessing addresses cannot fill the store
+		_, found, er := s.addresses.Get(addr)
+		if er != nil {
+			return nil, er
+		}
+		if !found {
+			return nil, ErrInvalidPassword
+		}
+		if er = s.lockout.Attempt(addr, time.Now()); er != nil {
+			return nil, er
+		}
+	}
+	a, er := s.addresses.Unlock(addr, password)
+	if er != nil || !a.HasKeys() {
+		return nil, ErrInvalidPassword
+	}
+	if s.lockout != nil {
+		if er = s.lockout.Succeeded(addr); er != nil {
+			s.logger.Warn("failed to clear failed logins", zap.String("addr", addr), zap.Error(er))
+		}
+	}
+	return a, nil
+}
+
+// unlock replaces the read only timeline of a by a writable one and unlocks its key. If that fails the key is left
+// as it was. s.mtx must be held.
+func (s *PulpitService) unlock(a *address.Address) error {
+	tl, er := s.newTimeline(a)
+	if er != nil {
+		return er
+	}
+	if compositeTimeline, found := s.compositeTimelines[a.Address]; found {
+		_ = compositeTimeline.RemoveTimeline(a.Address)
+		if er = compositeTimeline.AddTimeline(tl); er != nil {
+			_ = compositeTimeline.LoadTimeline(&address.Address{Address: a.Address})
+			return er
+		}
+	}
+	s.timelines[a.Address] = tl
+	s.keyring.Unlock(a)
+	return nil
+}
+
+// keyLocked drops the writable timeline of addr (which holds its key), replacing it by a read only one in its
+// composite timeline
+func (s *PulpitService) keyLocked(addr string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.keyring.IsUnlocked(addr) {
+		return
+	}
+	// the api keys of addr may still be posting through it
+	if !s.apiKeyring.IsUnlocked(addr) {
+		delete(s.timelines, addr)
+	}
+	compositeTimeline, found := s.compositeTimelines[addr]
+	if !found {
+		return
+	}
+	_ = compositeTimeline.RemoveTimeline(addr)
+	if er := compositeTimeline.LoadTimeline(&address.Address{Address: addr}); er != nil {
+		s.logger.Warn("failed to reload timeline after locking", zap.String("addr", addr), zap.Error(er))
+	}
 }
 
 func (s *PulpitService) createTimeLine(a *address.Address) (*timeline.Timeline, error) {
-	gr := graph.New(s.nameSpace, a, s.node, s.logger)
-	tl, er := timeline.NewTimeline(s.nameSpace, a, gr, s.evmFactory, s.logger)
+	tl, er := s.newTimeline(a)
 	if er != nil {
 		return nil, er
 	}
@@ -435,6 +897,11 @@ func (s *PulpitService) createTimeLine(a *address.Address) (*timeline.Timeline,
 	return tl, nil
 }
 
+func (s *PulpitService) newTimeline(a *address.Address) (*timeline.Timeline, error) {
+	gr := graph.New(s.nameSpace, a, s.node, s.logger)
+	return timeline.NewTimeline(s.nameSpace, a, gr, s.evmFactory, s.logger)
+}
+
 func (s *PulpitService) createCompositeTimeLine(a *address.Address) (*timeline.CompositeTimeline, error) {
 	dao := timeline.NewCompositeDao(s.db, a.Address)
 	compositeTimeline, er := timeline.NewCompositeTimeline(s.nameSpace, s.node, s.evmFactory, s.logger, a.Address, dao)
@@ -512,10 +979,12 @@ func (s *PulpitService) addFile(ctx context.Context, name string) (string, error
 		return "", er
 	}
 
+	size, _ := someFile.Size()
 	cidFile, er := s.ipfs.Unixfs().Add(ctx, someFile)
 	if er != nil {
 		return "", er
 	}
+	metrics.MediaAdded(size)
 
 	fmt.Printf("Added file to IPFS with CID %s\n", cidFile.String())
 	return cidFile.String(), nil
@@ -530,7 +999,7 @@ func (s *PulpitService) extractAddress(ctx context.Context) string {
 	if !ok {
 		return ""
 	}
-	if _, exists := s.logins[addr]; !exists {
+	if !s.IsLoggedIn(addr) {
 		return ""
 	}
 	return addr
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const issuedBeforePrefix = "issuedBefore:"
+
+// Revocations keeps the ids of the revoked tokens until they would expire anyway, and for each subject (address)
+// the time before which all its tokens are revoked
+type Revocations struct {
+	store KeyValueStore
+}
+
+type revocation struct {
+	Id                string `json:"id"`
+	ExpiresAt         int64  `json:"expiresAt,omitempty"`
+	IssuedBeforeMicro int64  `json:"issuedBeforeMicro,omitempty"`
+}
+
+func NewRevocations(store KeyValueStore) *Revocations {
+	return &Revocations{store: store}
+}
+
+// Revoke records id as revoked until expiresAt. It returns ErrAlreadyRevoked if id was revoked already, so that
+// only one of concurrent revocations of the same id succeeds.
+func (r *Revocations) Revoke(id string, expiresAt time.Time) error {
+	b, er := json.Marshal(revocation{Id: id, ExpiresAt: expiresAt.Unix()})
+	if er != nil {
+		return er
+	}
+	stored, er := r.store.PutIfAbsent(id, b)
+	if er != nil {
+		return er
+	}
+	if !stored {
+		return ErrAlreadyRevoked
+	}
+	return nil
+}
+
+// IsRevoked tells if id was revoked
+func (r *Revocations) IsRevoked(id string) (bool, error) {
+	_, found, er := r.store.Get(id)
+	return found, er
+}
+
+// RevokeIssuedBefore revokes all the tokens of subject issued before t, with a precision of a microsecond, so a token
+// issued right after t (i.e. by a new login) is still valid
+func (r *Revocations) RevokeIssuedBefore(subject string, t time.Time) error {
+	id := issuedBeforePrefix + subject
+	b, er := json.Marshal(revocation{Id: id, IssuedBeforeMicro: t.UnixMicro()})
+	if er != nil {
+		return er
+	}
+	return r.store.Put(id, b)
+}
+
+// IsRevokedAt tells if the tokens of subject issued at issuedAt were revoked by RevokeIssuedBefore
+func (r *Revocations) IsRevokedAt(subject string, issuedAt time.Time) (bool, error) {
+	b, found, er := r.store.Get(issuedBeforePrefix + subject)
+	if er != nil || !found {
+		return false, er
+	}
+	rev := revocation{}
+	if er = json.Unmarshal(b, &rev); er != nil {
+		return false, er
+	}
+	return issuedAt.UnixMicro() < rev.IssuedBeforeMicro, nil
+}
+
+// Purge removes the revocations that are already expired
+func (r *Revocations) Purge(now time.Time) (int, error) {
+	all, er := r.store.GetAll()
+	if er != nil {
+		return 0, er
+	}
+	purged := 0
+	for _, b := range all {
+		rev := revocation{}
+		if er = json.Unmarshal(b, &rev); er != nil {
+			return purged, er
+		}
+		// the revocations by issue time never expire
+		if rev.ExpiresAt == 0 || rev.ExpiresAt > now.Unix() {
+			continue
+		}
+		if er = r.store.Delete(rev.Id); er != nil {
+			return purged, er
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Revocations", func() {
+	tb := withTempBolt()
+	var revocations *Revocations
+
+	BeforeEach(func() {
+		revocations = NewRevocations(NewBoltKeyValueStore(tb.db, "revocations"))
+	})
+
+	It("Should revoke an id only once and keep it across restarts", func() {
+		Expect(revocations.Revoke("jti", time.Now().Add(time.Hour))).To(Succeed())
+		Expect(revocations.Revoke("jti", time.Now().Add(time.Hour))).To(MatchError(ErrAlreadyRevoked))
+
+		tb.reopen()
+		revocations = NewRevocations(NewBoltKeyValueStore(tb.db, "revocations"))
+		Expect(revocations.IsRevoked("jti")).To(BeTrue())
+		Expect(revocations.IsRevoked("other")).To(BeFalse())
+	})
+
+	It("Should revoke the tokens issued before a time, to the microsecond", func() {
+		t := time.Now()
+		Expect(revocations.RevokeIssuedBefore("addr", t)).To(Succeed())
+
+		Expect(revocations.IsRevokedAt("addr", t.Add(-time.Microsecond))).To(BeTrue())
+		Expect(revocations.IsRevokedAt("addr", t.Truncate(time.Microsecond))).To(BeFalse())
+		Expect(revocations.IsRevokedAt("addr", t.Add(time.Microsecond))).To(BeFalse())
+		Expect(revocations.IsRevokedAt("other", t.Add(-time.Second))).To(BeFalse())
+	})
+
+	It("Should purge only the expired revocations of ids", func() {
+		now := time.Now()
+		Expect(revocations.Revoke("expired", now.Add(-time.Minute))).To(Succeed())
+		Expect(revocations.Revoke("valid", now.Add(time.Minute))).To(Succeed())
+		Expect(revocations.RevokeIssuedBefore("addr", now.Add(-time.Hour))).To(Succeed())
+
+		Expect(revocations.Purge(now)).To(Equal(1))
+		Expect(revocations.IsRevoked("expired")).To(BeFalse())
+		Expect(revocations.IsRevoked("valid")).To(BeTrue())
+		Expect(revocations.IsRevokedAt("addr", now.Add(-2*time.Hour))).To(BeTrue())
+	})
+})
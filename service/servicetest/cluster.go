@@ -0,0 +1,186 @@
+// Package servicetest runs several PulpitService instances in the same process, connected only to each other on
+// the loopback interface, so that the interaction between nodes can be tested without any external network.
+package servicetest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreapi"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/libp2p/go-libp2p/core/peer"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+
+	"github.com/msaldanha/setinstone/event"
+
+	"github.com/msaldanha/pulpit/server"
+	"github.com/msaldanha/pulpit/server/ipfs"
+	"github.com/msaldanha/pulpit/service"
+)
+
+const nameSpace = "pulpit"
+
+// Node is one of the cluster members
+type Node struct {
+	Service  *service.PulpitService
+	Ipfs     icore.CoreAPI
+	IpfsNode *core.IpfsNode
+	DB       *bolt.DB
+
+	ipfsServer *ipfs.IpfsServer
+	evmf       event.ManagerFactory
+}
+
+// Cluster holds nodes started by NewCluster. It must be closed by the caller.
+type Cluster struct {
+	Nodes []*Node
+
+	dir    string
+	logger *zap.Logger
+}
+
+// NewCluster starts n nodes, each with its own ephemeral IPFS node, migrated bolt file and event manager factory, and
+// connects all of them to each other.
+func NewCluster(ctx context.Context, n int, logger *zap.Logger) (*Cluster, error) {
+	dir, er := os.MkdirTemp("", "pulpit-cluster")
+	if er != nil {
+		return nil, er
+	}
+	c := &Cluster{dir: dir, logger: logger}
+
+	for i := 0; i < n; i++ {
+		node, er := c.startNode(ctx, i)
+		if er != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("failed to start node %d: %w", i, er)
+		}
+		c.Nodes = append(c.Nodes, node)
+	}
+
+	if er = c.ConnectAll(ctx); er != nil {
+		_ = c.Close()
+		return nil, er
+	}
+
+	return c, nil
+}
+
+// ConnectAll connects every node to all the others
+func (c *Cluster) ConnectAll(ctx context.Context) error {
+	for i, a := range c.Nodes {
+		for _, b := range c.Nodes[i+1:] {
+			if er := Connect(ctx, a, b); er != nil {
+				return er
+			}
+		}
+	}
+	return nil
+}
+
+// Connect connects node a to node b
+func Connect(ctx context.Context, a, b *Node) error {
+	info := peer.AddrInfo{
+		ID:    b.IpfsNode.Identity,
+		Addrs: b.IpfsNode.PeerHost.Addrs(),
+	}
+	if er := a.Ipfs.Swarm().Connect(ctx, info); er != nil {
+		return fmt.Errorf("failed to connect %s to %s: %w", a.IpfsNode.Identity, b.IpfsNode.Identity, er)
+	}
+	return nil
+}
+
+// Close stops all the nodes and removes their files
+func (c *Cluster) Close() error {
+	var err error
+	for _, node := range c.Nodes {
+		if er := node.close(); er != nil && err == nil {
+			err = er
+		}
+	}
+	c.Nodes = nil
+	if er := os.RemoveAll(c.dir); er != nil && err == nil {
+		err = er
+	}
+	return err
+}
+
+func (c *Cluster) startNode(ctx context.Context, i int) (*Node, error) {
+	logger := c.logger.Named("node-" + strconv.Itoa(i))
+	node := &Node{}
+
+	node.ipfsServer = ipfs.NewIpfsServer(logger, ipfs.ServerOptions{
+		IpfsPort:        "0",
+		IpfsApiPort:     "0",
+		IpfsGatewayPort: "0",
+		SwarmAddrs:      []string{"/ip4/127.0.0.1/tcp/0"},
+		LanMode:         true,
+	})
+	ipfsNode, er := node.ipfsServer.SpawnEphemeral(ctx)
+	if er != nil {
+		_ = node.ipfsServer.Stop()
+		return nil, er
+	}
+	node.IpfsNode = ipfsNode
+
+	node.Ipfs, er = coreapi.NewCoreAPI(ipfsNode)
+	if er != nil {
+		_ = node.close()
+		return nil, er
+	}
+
+	node.evmf, er = event.NewManagerFactory(nameSpace, node.Ipfs.PubSub(), ipfsNode.Identity)
+	if er != nil {
+		_ = node.close()
+		return nil, er
+	}
+
+	path := filepath.Join(c.dir, "node-"+strconv.Itoa(i)+".dat")
+	node.DB, er = server.OpenDataStore(path)
+	if er != nil {
+		_ = node.close()
+		return nil, er
+	}
+
+	if _, er = server.Migrate(node.DB, path, false); er != nil {
+		_ = node.close()
+		return nil, er
+	}
+
+	subsStore, er := server.NewSubscriptionsStore(node.DB)
+	if er != nil {
+		_ = node.close()
+		return nil, er
+	}
+
+	node.Service = service.NewPulpitService(nameSpace, server.NewAddressStore(node.DB), node.Ipfs, ipfsNode, node.evmf,
+		logger, subsStore, node.DB, 0, nil, server.NewApiKeys(node.DB))
+
+	return node, nil
+}
+
+func (n *Node) close() error {
+	var err error
+	if n.Service != nil {
+		n.Service.Close()
+	}
+	if closer, ok := n.evmf.(io.Closer); ok {
+		if er := closer.Close(); er != nil {
+			err = er
+		}
+	}
+	if n.DB != nil {
+		if er := n.DB.Close(); er != nil && err == nil {
+			err = er
+		}
+	}
+	if er := n.ipfsServer.Stop(); er != nil && err == nil {
+		err = er
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package servicetest
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/msaldanha/timeline"
+
+	"github.com/msaldanha/pulpit/models"
+	"github.com/msaldanha/pulpit/service"
+)
+
+const pass = "123456"
+
+var _ = Describe("Cluster", func() {
+	var (
+		ctx     context.Context
+		cluster *Cluster
+	)
+
+	BeforeEach(func() {
+		var er error
+		ctx = context.Background()
+		cluster, er = NewCluster(ctx, 2, zap.NewNop())
+		Expect(er).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).To(Succeed())
+	})
+
+	login := func(ps *service.PulpitService) string {
+		addr, er := ps.CreateAddress(ctx, pass)
+		Expect(er).To(BeNil())
+		Expect(ps.Login(ctx, addr, pass)).To(Succeed())
+		return addr
+	}
+
+	post := func(ps *service.PulpitService, addr, body string) string {
+		key, er := ps.CreateItem(ctx, addr, "", "", models.AddItemRequest{
+			Type: timeline.TypePost,
+			PostItem: models.PostItem{
+				Part:       timeline.Part{MimeType: "text/plain", Body: body},
+				Connectors: []string{"like"},
+			},
+		})
+		Expect(er).To(BeNil())
+		Expect(key).NotTo(BeEmpty())
+		return key
+	}
+
+	keys := func(items []timeline.Item) []string {
+		k := []string{}
+		for _, item := range items {
+			k = append(k, item.Key)
+		}
+		return k
+	}
+
+	It("Should connect the nodes to each other", func() {
+		a, b := cluster.Nodes[0], cluster.Nodes[1]
+		peers, er := a.Ipfs.Swarm().Peers(ctx)
+		Expect(er).To(BeNil())
+		Expect(peers).To(HaveLen(1))
+		Expect(peers[0].ID()).To(Equal(b.IpfsNode.Identity))
+	})
+
+	It("Should show the posts of A to B subscribed to A", func() {
+		a, b := cluster.Nodes[0], cluster.Nodes[1]
+		addrA := login(a.Service)
+		addrB := login(b.Service)
+
+		Expect(b.Service.AddSubscription(ctx, models.Subscription{Owner: addrB, Address: addrA})).To(Succeed())
+
+		key := post(a.Service, addrA, "Message 1")
+
+		Eventually(func() []string {
+			items, _ := b.Service.GetSubscriptionsPublications(ctx, addrB, "", 10)
+			return keys(items)
+		}, 30*time.Second, 500*time.Millisecond).Should(ContainElement(key))
+	})
+
+	It("Should read the timeline of A from B", func() {
+		a, b := cluster.Nodes[0], cluster.Nodes[1]
+		addrA := login(a.Service)
+
+		key := post(a.Service, addrA, "Message 1")
+
+		Eventually(func() []string {
+			items, _ := b.Service.GetItems(ctx, addrA, "", "", "", "", 10)
+			return keys(items)
+		}, 30*time.Second, 500*time.Millisecond).Should(ContainElement(key))
+	})
+})
@@ -0,0 +1,13 @@
+package servicetest
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestServicetest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Servicetest Suite")
+}
@@ -7,6 +7,7 @@ import (
 type KeyValueStore interface {
 	Init(options interface{}) error
 	Put(key string, value []byte) error
+	PutIfAbsent(key string, value []byte) (bool, error)
 	Get(key string) ([]byte, bool, error)
 	GetAll() ([][]byte, error)
 	Delete(key string) error
@@ -46,6 +47,20 @@ func (st *BoltKeyValueStore) Put(key string, value []byte) error {
 	})
 }
 
+// PutIfAbsent stores value unless key is already stored, in a single transaction. It tells if value was stored.
+func (st *BoltKeyValueStore) PutIfAbsent(key string, value []byte) (bool, error) {
+	stored := false
+	er := st.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(st.BucketName))
+		if b.Get([]byte(key)) != nil {
+			return nil
+		}
+		stored = true
+		return b.Put([]byte(key), value)
+	})
+	return stored, er
+}
+
 func (st *BoltKeyValueStore) Get(key string) (ret []byte, ok bool, er error) {
 	ok = false
 	ret = nil
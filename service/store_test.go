@@ -0,0 +1,43 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	bolt "go.etcd.io/bbolt"
+)
+
+// tempBolt is a bolt file in its own temporary directory
+type tempBolt struct {
+	dir string
+	db  *bolt.DB
+}
+
+// withTempBolt opens a new bolt file before each spec of the container and removes it after
+func withTempBolt() *tempBolt {
+	t := &tempBolt{}
+	BeforeEach(func() {
+		var er error
+		t.dir, er = os.MkdirTemp("", "pulpit-service")
+		Expect(er).To(BeNil())
+		t.db, er = bolt.Open(filepath.Join(t.dir, "test.dat"), 0600, &bolt.Options{Timeout: 1 * time.Second})
+		Expect(er).To(BeNil())
+	})
+	AfterEach(func() {
+		_ = t.db.Close()
+		_ = os.RemoveAll(t.dir)
+	})
+	return t
+}
+
+// reopen closes the bolt file and opens it again
+func (t *tempBolt) reopen() {
+	path := t.db.Path()
+	Expect(t.db.Close()).To(Succeed())
+	var er error
+	t.db, er = bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	Expect(er).To(BeNil())
+}
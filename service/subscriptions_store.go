@@ -112,6 +112,21 @@ func (s *SubscriptionsStoreImpl) GetOwners() ([]string, error) {
 	})
 }
 
+func (s *SubscriptionsStoreImpl) Count() (int, error) {
+	count := 0
+	er := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.BucketName))
+		if b == nil {
+			return nil
+		}
+		return b.ForEachBucket(func(k []byte) error {
+			count += b.Bucket(k).Stats().KeyN
+			return nil
+		})
+	})
+	return count, er
+}
+
 func (s *SubscriptionsStoreImpl) RemoveAllSubscriptions() error {
 	err := s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(s.BucketName))